@@ -2,80 +2,94 @@ package collector
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	etypes "github.com/docker/docker/api/types/events"
 	dockerclient "github.com/docker/docker/client"
-	msgbusclient "github.com/prologic/msgbus/client"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/docker/docker/api/types"
-	"github.com/prologic/msgbus"
 
 	"github.com/prologic/autodock/config"
 	"github.com/prologic/autodock/events"
+	"github.com/prologic/autodock/recent"
 )
 
-var (
-	errChan      chan (error)
-	eventChan    chan *events.Message
-	eventErrChan chan (error)
-	restartChan  chan (bool)
-	recoverChan  chan (bool)
-)
-
-// Publisher ...
-type Publisher interface {
-	Publish(topic string, payload []byte) error
-}
-
-// MessageBusLocalPublisher ...
-type MessageBusLocalPublisher struct {
-	msgbus *msgbus.MessageBus
-}
-
-// NewMessageBusLocalPublisher ...
-func NewMessageBusLocalPublisher(msgbus *msgbus.MessageBus) *MessageBusLocalPublisher {
-	return &MessageBusLocalPublisher{msgbus}
-}
-
-// Publish ...
-func (p *MessageBusLocalPublisher) Publish(topic string, payload []byte) error {
-	message := p.msgbus.NewMessage(p.msgbus.NewTopic(topic), payload)
-	p.msgbus.Put(message)
-	return nil
-}
+// eventBufferSize is the number of events buffered between the Docker
+// event stream and the publisher unless configured otherwise
+const eventBufferSize = 1000
 
-// MessageBusRemotePublisher ...
-type MessageBusRemotePublisher struct {
-	client *msgbusclient.Client
-}
+// recentEventsSize is the number of recent events remembered to discard
+// duplicates replayed by Docker after reconnecting
+const recentEventsSize = 512
 
-// NewMessageBusRemotePublisher ...
-func NewMessageBusRemotePublisher(url string) *MessageBusRemotePublisher {
-	client := msgbusclient.NewClient(url, nil)
-	return &MessageBusRemotePublisher{client}
-}
+// errResubscribe is returned by stream when the subscription should be
+// replaced, e.g. because the filters changed
+var errResubscribe = errors.New("resubscribing to event stream")
 
-// Publish ...
-func (p *MessageBusRemotePublisher) Publish(topic string, payload []byte) error {
-	return p.client.Publish(topic, string(payload))
-}
+// streamSettleTime is how long a new event stream must run without errors
+// to be considered connected if no events are received
+var streamSettleTime = time.Second
 
-// Collector ...
+// Collector subscribes to the Docker event stream and publishes each event
+// it receives. A Collector owns its channels and Docker client so several
+// collectors may run in the same process.
 type Collector struct {
+	sync.Mutex
+
 	cfg       *config.Config
 	client    *dockerclient.Client
 	publisher Publisher
+
+	eventChan chan *events.Message
+	errChan   chan error
+	state     State
+
+	// dropped is the number of events dropped because eventChan was full;
+	// dropping is set while events are being dropped
+	dropped  uint64
+	dropping bool
+
+	// since is the TimeNano of the newest event received, used to resume
+	// the event stream after reconnecting without missing events
+	since  int64
+	recent *recent.Set
+
+	filter      *Filter
+	resubscribe chan struct{}
+	enricher    *enricher
+
+	middleware []events.Middleware
+	handlers   []events.Handler
+	observer   Observer
+
+	cancel context.CancelFunc
+	done   chan struct{}
 }
 
 // NewCollector ...
 func NewCollector(cfg *config.Config, publisher Publisher) (*Collector, error) {
+	size := cfg.Collector.Queue.Size
+	if size == 0 {
+		size = eventBufferSize
+	}
+
 	c := &Collector{
 		cfg:       cfg,
 		publisher: publisher,
+
+		eventChan: make(chan *events.Message, size),
+		errChan:   make(chan error, 1),
+		state:     StateDisconnected,
+		recent:    recent.NewSet(recentEventsSize),
+
+		filter:      NewFilter(cfg.Collector.Filters),
+		resubscribe: make(chan struct{}, 1),
+		observer:    nopObserver{},
 	}
 
 	client, err := c.getDockerClient()
@@ -83,125 +97,266 @@ func NewCollector(cfg *config.Config, publisher Publisher) (*Collector, error) {
 		return nil, err
 	}
 	c.client = client
+	c.enricher = newEnricher(client, cfg.Collector.Enrich)
 
-	// channel setup
-	errChan = make(chan error)
-	eventErrChan = make(chan error)
-	restartChan = make(chan bool)
-	recoverChan = make(chan bool)
-	eventChan = make(chan *events.Message)
+	return c, nil
+}
+
+// Start starts collecting and publishing events in the background until
+// ctx is done or the collector is stopped.
+func (c *Collector) Start(ctx context.Context) error {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.done != nil {
+		return fmt.Errorf("collector already started")
+	}
+
+	ctx, c.cancel = context.WithCancel(ctx)
+	c.done = make(chan struct{})
+
+	var wg sync.WaitGroup
+	wg.Add(2)
 
-	// eventErrChan handler
-	// this handles event stream errors
 	go func() {
-		for range eventErrChan {
-			// error from swarm event stream; attempt to restart
-			log.Error("event stream fail; attempting to reconnect")
-			c.waitForSwarm()
-			restartChan <- true
-		}
+		defer wg.Done()
+		c.collect(ctx)
 	}()
 
-	// errChan handler
-	// this is a general error handling channel
 	go func() {
-		for err := range errChan {
-			log.Error(err)
-			// HACK: check for errors from swarm and restart
-			// events.  an example is "No primary manager elected"
-			// before the event handler is created and thus
-			// won't send the error there
-			if strings.Index(err.Error(), "500 Internal Server Error") > -1 {
-				log.Error("swarm error detected")
-
-				c.waitForSwarm()
-
-				restartChan <- true
-			}
-		}
+		defer wg.Done()
+		c.publishEvents(ctx)
 	}()
 
-	// restartChan handler
 	go func() {
-		for range restartChan {
-			log.Debug("starting event handling")
-
-			log.Debug("using event stream")
-			ctx, cancel := context.WithCancel(context.Background())
-			evtChan, evtErrChan := client.Events(ctx, types.EventsOptions{})
-			defer cancel()
-
-			go func(ch <-chan error) {
-				for {
-					err := <-ch
-					eventErrChan <- err
-				}
-			}(evtErrChan)
+		wg.Wait()
+		close(c.done)
+	}()
 
-			// since the event stream channel is receive
-			// only we wrap it to be able to send
-			// autodock events on the autodock chan
-			go func(ch <-chan etypes.Message) {
-				for {
-					msg := <-ch
-					m := &events.Message{msg}
+	return nil
+}
 
-					eventChan <- m
-				}
-			}(evtChan)
-
-			// trigger initial load
-			eventChan <- &events.Message{
-				etypes.Message{
-					ID:     "0",
-					Status: "autodock-start",
-				},
-			}
+// Stop stops the collector, waiting for any events already received to be
+// published, and closes its Docker client.
+func (c *Collector) Stop() error {
+	return c.Shutdown(context.Background())
+}
+
+// Shutdown stops collecting events, publishes any events already received
+// and closes the Docker client. It waits for pending events to be published
+// until ctx is done; the Docker client is closed regardless.
+func (c *Collector) Shutdown(ctx context.Context) error {
+	c.Lock()
+	cancel, done := c.cancel, c.done
+	c.Unlock()
 
+	var err error
+
+	if cancel != nil {
+		cancel()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			err = fmt.Errorf("error flushing events: %s", ctx.Err())
 		}
-	}()
+	}
 
-	go func() {
-		for e := range eventChan {
-			log.Debugf(
-				"event received: id=%s, type=%s status=%s action=%s",
-				e.ID, e.Type, e.Status, e.Action,
-			)
+	if cerr := c.client.Close(); err == nil {
+		err = cerr
+	}
 
-			if e.ID == "" && e.Type == "" {
+	return err
+}
+
+// stream forwards messages from a single subscription to the Docker event
+// stream until it fails or ctx is done. The subscription is always closed
+// before returning. connected is called once the subscription is known to
+// be healthy: after the first message or streamSettleTime without errors.
+func (c *Collector) stream(ctx context.Context, connected func()) error {
+	log.Debug("starting event handling")
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	c.Lock()
+	filter := c.filter
+	c.Unlock()
+
+	options := types.EventsOptions{Filters: filter.Args()}
+	if c.since > 0 {
+		// resume from the last event received; Docker includes events at
+		// exactly this time which are discarded as duplicates
+		options.Since = fmt.Sprintf("%d.%09d", c.since/int64(time.Second), c.since%int64(time.Second))
+	}
+
+	log.Debugf("using event stream (since=%q)", options.Since)
+	msgs, errs := c.client.Events(ctx, options)
+
+	settled := time.After(streamSettleTime)
+
+	for {
+		select {
+		case <-settled:
+			settled = nil
+			connected()
+		case msg := <-msgs:
+			if settled != nil {
+				settled = nil
+				connected()
+			}
+			if c.duplicate(msg) {
+				log.Debugf("discarding duplicate event: %s %s %s", msg.Type, msg.Action, msg.Actor.ID)
 				continue
 			}
+			// arguments such as the command of "exec_start: sh -c ..." are
+			// left out so that each command isn't counted separately
+			action := strings.SplitN(msg.Action, ":", 2)[0]
+			c.observer.EventReceived(msg.Type, action, time.Unix(0, msg.TimeNano))
+			c.send(ctx, events.NewMessage(msg))
+		case <-c.resubscribe:
+			return errResubscribe
+		case err := <-errs:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
 
-			topic := string(e.Type)
-			payload, err := json.Marshal(e)
-			if err != nil {
-				log.Errorf("error encoding event: %s", err)
-			} else {
-				err := c.publisher.Publish(topic, payload)
-				if err != nil {
-					log.Errorf("error publishing event %s: %s", topic, err)
-				}
+// duplicate records msg as received and returns true if it was already
+// received, as happens when events are replayed after reconnecting
+func (c *Collector) duplicate(msg etypes.Message) bool {
+	key := fmt.Sprintf("%d/%s/%s/%s/%s", msg.TimeNano, msg.Type, msg.Action, msg.Actor.ID, msg.Status)
+	if !c.recent.Add(key) {
+		return true
+	}
+
+	if msg.TimeNano > c.since {
+		c.since = msg.TimeNano
+	}
+
+	return false
+}
+
+// SetFilter replaces the filter selecting which events are published and
+// resubscribes to the event stream, resuming from the last event received
+func (c *Collector) SetFilter(filter *Filter) {
+	c.Lock()
+	c.filter = filter
+	c.Unlock()
+
+	select {
+	case c.resubscribe <- struct{}{}:
+	default:
+	}
+}
+
+// send queues an event for publishing. If the queue is full send waits
+// until there is room or ctx is done, or drops an event, according to the
+// overflow policy.
+func (c *Collector) send(ctx context.Context, e *events.Message) {
+	switch c.cfg.Collector.Queue.Overflow {
+	case config.OverflowDropNewest:
+		select {
+		case c.eventChan <- e:
+			c.recovered()
+		default:
+			c.drop(e)
+		}
+	case config.OverflowDropOldest:
+		for {
+			select {
+			case c.eventChan <- e:
+				c.recovered()
+				return
+			default:
+			}
+
+			select {
+			case old := <-c.eventChan:
+				c.drop(old)
+			default:
 			}
 		}
-	}()
+	default:
+		select {
+		case c.eventChan <- e:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// drop records an event dropped because the queue is full
+func (c *Collector) drop(e *events.Message) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.dropped++
+	if !c.dropping {
+		c.dropping = true
+		log.Warnf(
+			"publish queue full (%d events), dropping events (overflow=%s)",
+			cap(c.eventChan), c.cfg.Collector.Queue.Overflow,
+		)
+	}
+	log.Debugf("dropped event: type=%s action=%s id=%s", e.Type, e.Action, e.Actor.ID)
+}
 
-	// start event handler
-	restartChan <- true
+// recovered logs once events are no longer dropped
+func (c *Collector) recovered() {
+	c.Lock()
+	defer c.Unlock()
 
-	return c, nil
+	if c.dropping {
+		c.dropping = false
+		log.Infof("publish queue no longer full; %d events dropped in total", c.dropped)
+	}
 }
 
-func (c *Collector) waitForSwarm() {
-	log.Debug("waiting for event stream to become ready")
+// QueueLen returns the number of events waiting to be published
+func (c *Collector) QueueLen() int {
+	return len(c.eventChan)
+}
 
-	for {
-		if _, err := c.client.Info(context.Background()); err == nil {
-			log.Debug("event stream appears to have recovered; restarting handler")
-			return
-		}
+// QueueCap returns the number of events that can wait to be published
+func (c *Collector) QueueCap() int {
+	return cap(c.eventChan)
+}
+
+// Dropped returns the number of events dropped because the queue of events
+// waiting to be published was full
+func (c *Collector) Dropped() uint64 {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.dropped
+}
+
+// publishEvents passes received events through the pipeline until ctx is
+// done and then flushes any events still buffered
+func (c *Collector) publishEvents(ctx context.Context) {
+	pipeline := c.pipeline()
 
-		log.Warn("event stream not yet ready; retrying")
+	handle := func(e *events.Message) {
+		if err := pipeline.Handle(e); err != nil && err != events.ErrDrop {
+			log.Errorf("error handling event: %s", err)
+		}
+	}
 
-		time.Sleep(time.Second * 1)
+	for {
+		select {
+		case e := <-c.eventChan:
+			handle(e)
+		case <-ctx.Done():
+			for {
+				select {
+				case e := <-c.eventChan:
+					handle(e)
+				default:
+					return
+				}
+			}
+		}
 	}
 }
@@ -0,0 +1,634 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	etypes "github.com/docker/docker/api/types/events"
+
+	"github.com/prologic/autodock/config"
+	"github.com/prologic/autodock/events"
+)
+
+// fakeDocker is a minimal Docker daemon serving a fixed event stream. Each
+// subscription is served the next of streams and closed, except the last
+// which is held open.
+type fakeDocker struct {
+	*httptest.Server
+	sync.Mutex
+
+	streams    [][]etypes.Message
+	since      []string
+	fail       bool
+	containers []types.Container
+
+	// inspect serves container inspect calls by container ID
+	inspect  map[string]types.ContainerJSON
+	inspects int
+}
+
+// newFakeDocker starts a fake Docker daemon; it must be closed with Close
+func newFakeDocker(messages ...etypes.Message) *fakeDocker {
+	d := &fakeDocker{streams: [][]etypes.Message{messages}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1.39/events", func(w http.ResponseWriter, r *http.Request) {
+		if d.fail {
+			http.Error(w, "No elected primary cluster manager", http.StatusInternalServerError)
+			return
+		}
+
+		d.Lock()
+		n := len(d.since)
+		d.since = append(d.since, r.URL.Query().Get("since"))
+		var messages []etypes.Message
+		if n < len(d.streams) {
+			messages = d.streams[n]
+		}
+		d.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		for _, msg := range messages {
+			enc.Encode(msg)
+		}
+		w.(http.Flusher).Flush()
+
+		if n >= len(d.streams)-1 {
+			<-r.Context().Done()
+		}
+	})
+	mux.HandleFunc("/v1.39/info", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	})
+	mux.HandleFunc("/v1.39/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(d.containers)
+	})
+	mux.HandleFunc("/v1.39/containers/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1.39/containers/"), "/json")
+
+		d.Lock()
+		d.inspects++
+		inspected, ok := d.inspect[id]
+		d.Unlock()
+
+		if !ok {
+			http.Error(w, `{"message":"No such container"}`, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(inspected)
+	})
+	mux.HandleFunc("/v1.39/networks", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[]"))
+	})
+	mux.HandleFunc("/v1.39/volumes", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Volumes":[]}`))
+	})
+
+	d.Server = httptest.NewServer(mux)
+
+	return d
+}
+
+func (d *fakeDocker) URL() string {
+	return strings.Replace(d.Server.URL, "http://", "tcp://", 1)
+}
+
+// recordingPublisher records everything published to it
+type recordingPublisher struct {
+	sync.Mutex
+	topics   []string
+	payloads [][]byte
+}
+
+func (p *recordingPublisher) Publish(topic string, payload []byte) error {
+	p.Lock()
+	defer p.Unlock()
+
+	p.topics = append(p.topics, topic)
+	p.payloads = append(p.payloads, payload)
+	return nil
+}
+
+// messages returns the Docker events published, ignoring autodock's own
+func (p *recordingPublisher) messages() []*events.Message {
+	p.Lock()
+	defer p.Unlock()
+
+	var messages []*events.Message
+	for _, payload := range p.payloads {
+		var m events.Message
+		json.Unmarshal(payload, &m)
+		if m.Type != "" && m.Type != events.AutodockEventType {
+			messages = append(messages, &m)
+		}
+	}
+	return messages
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(time.Second * 5)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func newTestCollector(t *testing.T, d *fakeDocker, publisher Publisher) *Collector {
+	cfg := config.Default()
+	cfg.DockerURL = d.URL()
+
+	c, err := NewCollector(cfg, publisher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func TestCollectorStartStop(t *testing.T) {
+	d := newFakeDocker(
+		etypes.Message{Type: "container", Action: "start", Actor: etypes.Actor{ID: "abc"}, TimeNano: 1},
+		etypes.Message{Type: "network", Action: "connect", Actor: etypes.Actor{ID: "def"}, TimeNano: 2},
+	)
+	defer d.Close()
+
+	publisher := &recordingPublisher{}
+	c := newTestCollector(t, d, publisher)
+
+	if err := c.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Start(context.Background()); err == nil {
+		t.Fatal("expected error starting collector twice")
+	}
+
+	waitFor(t, func() bool { return len(publisher.messages()) == 2 })
+
+	if err := c.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := publisher.messages()
+	if messages[0].Type != "container" || messages[1].Type != "network" {
+		t.Fatalf("unexpected events: %v", messages)
+	}
+}
+
+func TestMultipleCollectors(t *testing.T) {
+	d1 := newFakeDocker(etypes.Message{Type: "container", Action: "start", TimeNano: 1})
+	defer d1.Close()
+	d2 := newFakeDocker(etypes.Message{Type: "volume", Action: "create", TimeNano: 1})
+	defer d2.Close()
+
+	p1 := &recordingPublisher{}
+	p2 := &recordingPublisher{}
+
+	for _, c := range []*Collector{newTestCollector(t, d1, p1), newTestCollector(t, d2, p2)} {
+		if err := c.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		defer c.Stop()
+	}
+
+	waitFor(t, func() bool { return len(p1.messages()) == 1 && len(p2.messages()) == 1 })
+
+	if p1.messages()[0].Type != "container" || p2.messages()[0].Type != "volume" {
+		t.Fatal("events published to wrong publisher")
+	}
+}
+
+func TestCollectorFatalPolicy(t *testing.T) {
+	d := newFakeDocker()
+	defer d.Close()
+	d.fail = true
+
+	publisher := &recordingPublisher{}
+	c := newTestCollector(t, d, publisher)
+	c.cfg.Collector.Backoff.Min.Duration = time.Millisecond
+	c.cfg.Collector.Backoff.Max.Duration = time.Millisecond * 10
+	c.cfg.Collector.Backoff.MaxRetries = 2
+	c.cfg.Collector.Backoff.Fatal = true
+
+	if err := c.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	select {
+	case err := <-c.Err():
+		if err == nil {
+			t.Fatal("expected fatal error")
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for collector to give up")
+	}
+
+	if state := c.State(); state != StateFailed {
+		t.Fatalf("expected state %s; got %s", StateFailed, state)
+	}
+
+	var states []string
+	waitFor(t, func() bool {
+		publisher.Lock()
+		defer publisher.Unlock()
+
+		states = nil
+		for i, topic := range publisher.topics {
+			if events.MatchTopicOrParent(events.AutodockEventType, topic) {
+				var m events.Message
+				json.Unmarshal(publisher.payloads[i], &m)
+				if m.Action != ActionSnapshot {
+					states = append(states, m.Action)
+				}
+			}
+		}
+		return len(states) == 2
+	})
+
+	expected := []string{"reconnecting", "failed"}
+	for i := range expected {
+		if states[i] != expected[i] {
+			t.Fatalf("expected state transitions %v; got %v", expected, states)
+		}
+	}
+}
+
+func TestCollectorRetriesReset(t *testing.T) {
+	d := newFakeDocker()
+	defer d.Close()
+	// each stream but the last connects and then ends straight away
+	d.streams = [][]etypes.Message{
+		{{Type: "container", Action: "start", Actor: etypes.Actor{ID: "a"}, TimeNano: 1}},
+		{{Type: "container", Action: "start", Actor: etypes.Actor{ID: "a"}, TimeNano: 2}},
+		{{Type: "container", Action: "start", Actor: etypes.Actor{ID: "a"}, TimeNano: 3}},
+		{{Type: "container", Action: "start", Actor: etypes.Actor{ID: "a"}, TimeNano: 4}},
+	}
+
+	publisher := &recordingPublisher{}
+	c := newTestCollector(t, d, publisher)
+	c.cfg.Collector.Backoff.Min.Duration = time.Millisecond
+	c.cfg.Collector.Backoff.MaxRetries = 1
+	c.cfg.Collector.Backoff.Fatal = true
+
+	if err := c.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	waitFor(t, func() bool { return len(publisher.messages()) == 4 })
+
+	// only consecutive failed attempts count towards max_retries
+	select {
+	case err := <-c.Err():
+		t.Fatalf("unexpected fatal error: %s", err)
+	default:
+	}
+	if state := c.State(); state != StateConnected {
+		t.Errorf("expected state %s; got %s", StateConnected, state)
+	}
+}
+
+func TestCollectorResumesAfterReconnect(t *testing.T) {
+	e1 := etypes.Message{Type: "container", Action: "start", Actor: etypes.Actor{ID: "a"}, TimeNano: 1000000010}
+	e2 := etypes.Message{Type: "container", Action: "die", Actor: etypes.Actor{ID: "a"}, TimeNano: 2000000020}
+	e3 := etypes.Message{Type: "container", Action: "die", Actor: etypes.Actor{ID: "b"}, TimeNano: 2000000020}
+	e4 := etypes.Message{Type: "container", Action: "start", Actor: etypes.Actor{ID: "a"}, TimeNano: 3000000030}
+
+	d := newFakeDocker()
+	defer d.Close()
+	d.streams = [][]etypes.Message{
+		{e1, e2},
+		// replayed from the time of e2, which is sent again
+		{e2, e3, e4},
+	}
+
+	publisher := &recordingPublisher{}
+	c := newTestCollector(t, d, publisher)
+	c.cfg.Collector.Backoff.Min.Duration = time.Millisecond
+
+	if err := c.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	waitFor(t, func() bool { return len(publisher.messages()) >= 4 })
+
+	d.Lock()
+	since := d.since
+	d.Unlock()
+
+	if len(since) != 2 || since[0] != "" || since[1] != "2.000000020" {
+		t.Fatalf("unexpected since parameters: %q", since)
+	}
+
+	messages := publisher.messages()
+	if len(messages) != 4 {
+		t.Fatalf("expected 4 events; got %d", len(messages))
+	}
+	for i, expected := range []etypes.Message{e1, e2, e3, e4} {
+		if messages[i].Action != expected.Action || messages[i].Actor.ID != expected.Actor.ID {
+			t.Errorf("event %d: expected %s %s; got %s %s", i,
+				expected.Action, expected.Actor.ID, messages[i].Action, messages[i].Actor.ID)
+		}
+	}
+}
+
+func TestCollectorSnapshot(t *testing.T) {
+	d := newFakeDocker(etypes.Message{Type: "container", Action: "die", Actor: etypes.Actor{ID: "a"}, TimeNano: 1})
+	defer d.Close()
+	d.containers = []types.Container{
+		{ID: "a", Names: []string{"/web_1"}, Image: "nginx", State: "running", Labels: map[string]string{"app": "web"}},
+		{ID: "b", Names: []string{"/db_1"}, Image: "postgres", State: "exited"},
+	}
+
+	publisher := &recordingPublisher{}
+	c := newTestCollector(t, d, publisher)
+
+	if err := c.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	waitFor(t, func() bool { return len(publisher.messages()) == 3 })
+
+	messages := publisher.messages()
+	for i, id := range []string{"a", "b"} {
+		m := messages[i]
+		if m.Action != ActionExists || m.Actor.ID != id {
+			t.Fatalf("expected exists event for %s; got %s %s", id, m.Action, m.Actor.ID)
+		}
+	}
+	if name := messages[0].Actor.Attributes["name"]; name != "web_1" {
+		t.Errorf("expected name web_1; got %q", name)
+	}
+	if app := messages[0].Actor.Attributes["app"]; app != "web" {
+		t.Errorf("expected label app=web; got %q", app)
+	}
+	if messages[2].Action != "die" {
+		t.Errorf("expected die event after snapshot; got %s", messages[2].Action)
+	}
+
+	publisher.Lock()
+	defer publisher.Unlock()
+
+	for _, topic := range publisher.topics {
+		if topic == "autodock.snapshot.collector" {
+			return
+		}
+	}
+	t.Errorf("expected snapshot event; got topics %v", publisher.topics)
+}
+
+func TestCollectorResubscribe(t *testing.T) {
+	d := newFakeDocker(etypes.Message{Type: "container", Action: "die", Actor: etypes.Actor{ID: "a"}, TimeNano: 1})
+	defer d.Close()
+	d.containers = []types.Container{
+		{ID: "a", Names: []string{"/web_1"}, Image: "nginx", State: "running"},
+	}
+
+	publisher := &recordingPublisher{}
+	c := newTestCollector(t, d, publisher)
+
+	if err := c.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, func() bool { return len(publisher.messages()) == 2 })
+
+	// changing the filters resumes the stream without another snapshot
+	c.SetFilter(NewFilter(config.FilterConfig{}))
+	waitFor(t, func() bool {
+		d.Lock()
+		defer d.Unlock()
+		return len(d.since) == 2
+	})
+	if err := c.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	exists := 0
+	for _, m := range publisher.messages() {
+		if m.Action == ActionExists {
+			exists++
+		}
+	}
+	if exists != 1 {
+		t.Errorf("expected 1 exists event got %d", exists)
+	}
+
+	publisher.Lock()
+	defer publisher.Unlock()
+
+	snapshots := 0
+	for _, topic := range publisher.topics {
+		if topic == "autodock.snapshot.collector" {
+			snapshots++
+		}
+	}
+	if snapshots != 1 {
+		t.Errorf("expected 1 snapshot event got %d", snapshots)
+	}
+}
+
+func TestCollectorEnrich(t *testing.T) {
+	die := etypes.Message{
+		Type:   "container",
+		Action: "die",
+		Actor:  etypes.Actor{ID: "a", Attributes: map[string]string{"exitCode": "137"}},
+	}
+	d := newFakeDocker(
+		etypes.Message{Type: "container", Action: "kill", Actor: etypes.Actor{ID: "a"}, TimeNano: 1},
+		etypes.Message{Type: "container", Action: "exec_create: sh", Actor: etypes.Actor{ID: "a"}, TimeNano: 2},
+		etypes.Message{Type: "container", Action: "die", Actor: die.Actor, TimeNano: 3},
+		etypes.Message{Type: "container", Action: "destroy", Actor: etypes.Actor{ID: "a"}, TimeNano: 4},
+		etypes.Message{Type: "container", Action: "start", Actor: etypes.Actor{ID: "gone"}, TimeNano: 5},
+	)
+	defer d.Close()
+
+	d.inspect = map[string]types.ContainerJSON{
+		"a": {
+			ContainerJSONBase: &types.ContainerJSONBase{
+				Name:         "/web_1",
+				Image:        "sha256:abc",
+				RestartCount: 2,
+				State:        &types.ContainerState{Status: "exited"},
+			},
+			Config: &container.Config{
+				Image:  "nginx",
+				Labels: map[string]string{"com.docker.compose.project": "web"},
+			},
+		},
+	}
+
+	publisher := &recordingPublisher{}
+	c := newTestCollector(t, d, publisher)
+	c.cfg.Collector.Snapshot = false
+
+	if err := c.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	waitFor(t, func() bool { return len(publisher.messages()) == 5 })
+
+	messages := publisher.messages()
+	for _, m := range messages[:4] {
+		if m.Metadata == nil {
+			t.Fatalf("expected %s event to be enriched", m.Action)
+		}
+		if m.Metadata.Name != "web_1" || m.Metadata.Image != "nginx" || m.Metadata.Project != "web" {
+			t.Errorf("unexpected metadata: %+v", m.Metadata)
+		}
+	}
+	if code := messages[2].Metadata.ExitCode; code == nil || *code != 137 {
+		t.Errorf("expected exit code 137; got %v", code)
+	}
+	if messages[0].Metadata.ExitCode != nil {
+		t.Error("expected no exit code on kill event")
+	}
+	if messages[4].Metadata != nil {
+		t.Error("expected event for missing container not to be enriched")
+	}
+
+	// the exec and destroy events are enriched from the cache but events
+	// changing the container's state are always inspected
+	d.Lock()
+	defer d.Unlock()
+	if d.inspects != 3 {
+		t.Errorf("expected 3 inspect calls with caching; got %d", d.inspects)
+	}
+}
+
+func TestCollectorPipeline(t *testing.T) {
+	d := newFakeDocker(
+		etypes.Message{Type: "container", Action: "start", Actor: etypes.Actor{ID: "a"}, TimeNano: 1},
+		etypes.Message{Type: "network", Action: "connect", Actor: etypes.Actor{ID: "b"}, TimeNano: 2},
+		etypes.Message{Type: "volume", Action: "create", Actor: etypes.Actor{ID: "c"}, TimeNano: 3},
+	)
+	defer d.Close()
+
+	publisher := &recordingPublisher{}
+	c := newTestCollector(t, d, publisher)
+	c.cfg.Collector.Snapshot = false
+
+	// drop network events and label everything else
+	err := c.Use(
+		func(next events.Handler) events.Handler {
+			return events.HandlerFunc(func(e *events.Message) error {
+				if e.Type == "network" {
+					return events.ErrDrop
+				}
+				return next.Handle(e)
+			})
+		},
+		func(next events.Handler) events.Handler {
+			return events.HandlerFunc(func(e *events.Message) error {
+				if e.Actor.Attributes == nil {
+					e.Actor.Attributes = make(map[string]string)
+				}
+				e.Actor.Attributes["handled"] = "true"
+				return next.Handle(e)
+			})
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu      sync.Mutex
+		handled []string
+	)
+	c.Handle(events.HandlerFunc(func(e *events.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		handled = append(handled, e.Type)
+		return nil
+	}))
+
+	if err := c.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	if err := c.Use(); err == nil {
+		t.Error("expected error adding middleware after start")
+	}
+
+	waitFor(t, func() bool { return len(publisher.messages()) == 2 })
+
+	messages := publisher.messages()
+	if messages[0].Type != "container" || messages[1].Type != "volume" {
+		t.Fatalf("unexpected events published: %s, %s", messages[0].Type, messages[1].Type)
+	}
+	for _, m := range messages {
+		if m.Actor.Attributes["handled"] != "true" {
+			t.Errorf("expected %s event to be transformed", m.Type)
+		}
+	}
+
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(handled) >= 2
+	})
+}
+
+func TestCollectorQueueOverflow(t *testing.T) {
+	d := newFakeDocker()
+	defer d.Close()
+
+	testCases := []struct {
+		overflow string
+		expected []string
+	}{
+		{config.OverflowDropNewest, []string{"1", "2"}},
+		{config.OverflowDropOldest, []string{"3", "4"}},
+	}
+
+	for _, testCase := range testCases {
+		cfg := config.Default()
+		cfg.DockerURL = d.URL()
+		cfg.Collector.Queue = config.QueueConfig{Size: 2, Overflow: testCase.overflow}
+
+		c, err := NewCollector(cfg, &recordingPublisher{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// nothing is publishing so the queue fills up
+		for _, id := range []string{"1", "2", "3", "4"} {
+			c.send(context.Background(), events.NewMessage(etypes.Message{
+				Type: "container", Action: "start", Actor: etypes.Actor{ID: id},
+			}))
+		}
+
+		if c.QueueLen() != 2 || c.QueueCap() != 2 {
+			t.Errorf("%s: expected a full queue of 2 got %d/%d", testCase.overflow, c.QueueLen(), c.QueueCap())
+		}
+		if c.Dropped() != 2 {
+			t.Errorf("%s: expected 2 events dropped got %d", testCase.overflow, c.Dropped())
+		}
+
+		var queued []string
+		for len(c.eventChan) > 0 {
+			queued = append(queued, (<-c.eventChan).Actor.ID)
+		}
+		if strings.Join(queued, ",") != strings.Join(testCase.expected, ",") {
+			t.Errorf("%s: expected %v queued got %v", testCase.overflow, testCase.expected, queued)
+		}
+
+		c.client.Close()
+	}
+}
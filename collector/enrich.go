@@ -0,0 +1,223 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	etypes "github.com/docker/docker/api/types/events"
+	dockerclient "github.com/docker/docker/client"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/prologic/autodock/config"
+	"github.com/prologic/autodock/events"
+)
+
+// enrichTimeout is how long to wait for Docker when inspecting an object
+// to enrich an event; events are published in the meantime so this is kept
+// short
+const enrichTimeout = time.Millisecond * 500
+
+// refreshActions change the state, restart count, image, labels or name of
+// the objects they concern, so events with these actions are enriched with
+// freshly inspected metadata rather than the cached metadata
+var refreshActions = map[string]bool{
+	"start":   true,
+	"die":     true,
+	"restart": true,
+	"update":  true,
+	"rename":  true,
+}
+
+// removeActions are those of objects that no longer exist, so events with
+// these actions are only enriched with cached metadata
+var removeActions = map[string]bool{
+	"destroy": true,
+	"remove":  true,
+}
+
+type cachedMetadata struct {
+	metadata *events.Metadata
+	expires  time.Time
+}
+
+// enricher attaches metadata about the object an event concerns, caching
+// the result of inspecting objects for a short time as events for the same
+// object tend to arrive in bursts
+type enricher struct {
+	sync.Mutex
+
+	client *dockerclient.Client
+	types  map[string]bool
+	ttl    time.Duration
+
+	cache     map[string]cachedMetadata
+	lastSweep time.Time
+}
+
+func newEnricher(client *dockerclient.Client, cfg config.EnrichConfig) *enricher {
+	types := make(map[string]bool)
+	for _, typ := range cfg.Types {
+		types[typ] = true
+	}
+
+	return &enricher{
+		client: client,
+		types:  types,
+		ttl:    cfg.TTL.Duration,
+		cache:  make(map[string]cachedMetadata),
+	}
+}
+
+// Enrich sets the metadata of e if its type is enriched. Objects that
+// cannot be inspected, e.g. because they were removed, are left as is.
+func (en *enricher) Enrich(e *events.Message) {
+	if !en.types[e.Type] || e.Actor.ID == "" || e.Action == ActionExists {
+		return
+	}
+
+	var (
+		metadata *events.Metadata
+		err      error
+	)
+	if action := strings.SplitN(e.Action, ":", 2)[0]; removeActions[action] {
+		metadata, err = en.remove(e.Type, e.Actor.ID)
+	} else {
+		metadata, err = en.metadata(e.Type, e.Actor.ID, refreshActions[action])
+	}
+	if err != nil {
+		log.Debugf("not enriching %s %s event: %s", e.Type, e.Action, err)
+		return
+	}
+
+	// copy so that the cached metadata is not modified
+	m := *metadata
+	if code, ok := e.Actor.Attributes["exitCode"]; ok {
+		if n, err := strconv.Atoi(code); err == nil {
+			m.ExitCode = &n
+		}
+	}
+	e.Metadata = &m
+}
+
+// metadata returns the metadata of an object from the cache or, if not
+// cached, expired or refresh is set, by inspecting it
+func (en *enricher) metadata(typ, id string, refresh bool) (*events.Metadata, error) {
+	key := typ + "/" + id
+	now := time.Now()
+
+	en.Lock()
+	cached, ok := en.cache[key]
+	en.Unlock()
+	if ok && !refresh && now.Before(cached.expires) {
+		return cached.metadata, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), enrichTimeout)
+	defer cancel()
+
+	var (
+		metadata *events.Metadata
+		err      error
+	)
+	switch typ {
+	case etypes.ContainerEventType:
+		metadata, err = en.inspectContainer(ctx, id)
+	case etypes.ServiceEventType:
+		metadata, err = en.inspectService(ctx, id)
+	default:
+		err = fmt.Errorf("unsupported type %q", typ)
+	}
+	if err != nil {
+		if ok {
+			// the object was most likely removed; stale metadata is
+			// better than none
+			return cached.metadata, nil
+		}
+		return nil, err
+	}
+
+	en.Lock()
+	defer en.Unlock()
+
+	if now.Sub(en.lastSweep) > en.ttl {
+		for k, v := range en.cache {
+			if now.After(v.expires) {
+				delete(en.cache, k)
+			}
+		}
+		en.lastSweep = now
+	}
+	en.cache[key] = cachedMetadata{metadata, now.Add(en.ttl)}
+
+	return metadata, nil
+}
+
+// remove removes the metadata of a removed object from the cache and
+// returns it unless expired
+func (en *enricher) remove(typ, id string) (*events.Metadata, error) {
+	key := typ + "/" + id
+
+	en.Lock()
+	defer en.Unlock()
+
+	cached, ok := en.cache[key]
+	delete(en.cache, key)
+	if !ok || time.Now().After(cached.expires) {
+		return nil, fmt.Errorf("%s %s not cached", typ, id)
+	}
+	return cached.metadata, nil
+}
+
+func (en *enricher) inspectContainer(ctx context.Context, id string) (*events.Metadata, error) {
+	container, err := en.client.ContainerInspect(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := &events.Metadata{
+		Name:         strings.TrimPrefix(container.Name, "/"),
+		ImageID:      container.Image,
+		RestartCount: container.RestartCount,
+	}
+	if container.Config != nil {
+		metadata.Image = container.Config.Image
+		metadata.Labels = container.Config.Labels
+		metadata.Project = metadata.Labels["com.docker.compose.project"]
+		metadata.Service = metadata.Labels["com.docker.compose.service"]
+		if service, ok := metadata.Labels["com.docker.swarm.service.name"]; ok {
+			metadata.Service = service
+		}
+	}
+	if container.State != nil {
+		metadata.State = container.State.Status
+	}
+
+	return metadata, nil
+}
+
+func (en *enricher) inspectService(ctx context.Context, id string) (*events.Metadata, error) {
+	service, _, err := en.client.ServiceInspectWithRaw(ctx, id, types.ServiceInspectOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := &events.Metadata{
+		Name:    service.Spec.Name,
+		Labels:  service.Spec.Labels,
+		Project: service.Spec.Labels["com.docker.stack.namespace"],
+		Service: service.Spec.Name,
+	}
+	if spec := service.Spec.TaskTemplate.ContainerSpec; spec != nil {
+		metadata.Image = spec.Image
+	}
+	if replicated := service.Spec.Mode.Replicated; replicated != nil {
+		metadata.Replicas = replicated.Replicas
+	}
+
+	return metadata, nil
+}
@@ -0,0 +1,166 @@
+package collector
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultFanoutBuffer is the number of events buffered for each publisher
+// of a FanoutPublisher unless configured otherwise
+const DefaultFanoutBuffer = 1000
+
+type fanoutEvent struct {
+	topic   string
+	payload []byte
+}
+
+// fanoutSink is a publisher of a FanoutPublisher with its own buffer and
+// worker publishing events from it
+type fanoutSink struct {
+	name      string
+	publisher Publisher
+	observer  Observer
+	queue     chan fanoutEvent
+	done      chan struct{}
+}
+
+func (s *fanoutSink) run() {
+	defer close(s.done)
+
+	for e := range s.queue {
+		s.publish(e)
+	}
+}
+
+// publish publishes an event, recovering from panics so that a broken
+// publisher cannot take the others down with it
+func (s *fanoutSink) publish(e fanoutEvent) {
+	var err error
+
+	started := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("publisher %s: panic publishing event %s: %v", s.name, e.topic, r)
+			err = fmt.Errorf("panic: %v", r)
+		}
+		s.observer.EventPublished(s.name, time.Since(started), err)
+	}()
+
+	if err = s.publisher.Publish(e.topic, e.payload); err != nil {
+		log.Errorf("publisher %s: error publishing event %s: %s", s.name, e.topic, err)
+	}
+}
+
+// FanoutPublisher publishes each event to several publishers concurrently.
+// Each publisher has its own buffer and worker so that a slow or failing
+// publisher never blocks the caller or the other publishers; events that
+// don't fit in a publisher's buffer are dropped for that publisher only.
+type FanoutPublisher struct {
+	sync.RWMutex
+
+	sinks    []*fanoutSink
+	observer Observer
+	closed   bool
+}
+
+// NewFanoutPublisher ...
+func NewFanoutPublisher() *FanoutPublisher {
+	return &FanoutPublisher{observer: nopObserver{}}
+}
+
+// Observe sets the observer told how long each publisher takes to publish
+// each event and whether it failed. Observe must be called before Add.
+func (f *FanoutPublisher) Observe(observer Observer) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.observer = observer
+}
+
+// Add adds a publisher named name buffering up to buffer events
+func (f *FanoutPublisher) Add(name string, publisher Publisher, buffer int) {
+	if buffer <= 0 {
+		buffer = DefaultFanoutBuffer
+	}
+
+	f.Lock()
+	defer f.Unlock()
+
+	s := &fanoutSink{
+		name:      name,
+		publisher: publisher,
+		observer:  f.observer,
+		queue:     make(chan fanoutEvent, buffer),
+		done:      make(chan struct{}),
+	}
+	go s.run()
+
+	f.sinks = append(f.sinks, s)
+}
+
+// Publish queues an event for each publisher without waiting for it to be
+// published. An error is returned if any publisher's buffer is full.
+func (f *FanoutPublisher) Publish(topic string, payload []byte) error {
+	f.RLock()
+	defer f.RUnlock()
+
+	if f.closed {
+		return fmt.Errorf("error publishing event: publisher closed")
+	}
+
+	var errs []string
+
+	e := fanoutEvent{topic, payload}
+	for _, s := range f.sinks {
+		select {
+		case s.queue <- e:
+		default:
+			s.observer.EventDropped(s.name)
+			errs = append(errs, fmt.Sprintf("publisher %s: buffer full, event dropped", s.name))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// Close publishes the events buffered and then closes each publisher that
+// needs to be closed
+func (f *FanoutPublisher) Close() error {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+
+	for _, s := range f.sinks {
+		close(s.queue)
+	}
+
+	var errs []string
+
+	for _, s := range f.sinks {
+		<-s.done
+		if c, ok := s.publisher.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				errs = append(errs, fmt.Sprintf("publisher %s: %s", s.name, err))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
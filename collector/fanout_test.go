@@ -0,0 +1,63 @@
+package collector
+
+import (
+	"fmt"
+	"testing"
+)
+
+// blockingPublisher blocks publishing until unblocked
+type blockingPublisher struct {
+	recordingPublisher
+	unblock chan struct{}
+}
+
+func (p *blockingPublisher) Publish(topic string, payload []byte) error {
+	<-p.unblock
+	return p.recordingPublisher.Publish(topic, payload)
+}
+
+type failingPublisher struct{}
+
+func (failingPublisher) Publish(topic string, payload []byte) error {
+	panic("broken")
+}
+
+func TestFanoutPublisher(t *testing.T) {
+	fast := &recordingPublisher{}
+	slow := &blockingPublisher{unblock: make(chan struct{})}
+
+	f := NewFanoutPublisher()
+	f.Add("fast", fast, 10)
+	f.Add("slow", slow, 2)
+	f.Add("failing", failingPublisher{}, 10)
+
+	var errs int
+	for i := 0; i < 5; i++ {
+		if err := f.Publish(fmt.Sprintf("container.start.web_%d", i), nil); err != nil {
+			errs++
+		}
+	}
+
+	// the slow publisher holds one event and buffers two; the others are
+	// dropped for it only
+	waitFor(t, func() bool {
+		fast.Lock()
+		defer fast.Unlock()
+		return len(fast.topics) == 5
+	})
+	if errs == 0 {
+		t.Error("expected events to be dropped for the slow publisher")
+	}
+
+	close(slow.unblock)
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(slow.topics); n != 5-errs {
+		t.Errorf("expected %d events published by the slow publisher got %d", 5-errs, n)
+	}
+	if err := f.Publish("container.start.web_1", nil); err == nil {
+		t.Error("expected error publishing to closed publisher")
+	}
+}
@@ -0,0 +1,264 @@
+package collector
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/prologic/autodock/config"
+)
+
+// backupTimeFormat is the format of the time in the names of rotated
+// files; it sorts in chronological order
+const backupTimeFormat = "2006-01-02T15-04-05.000000000"
+
+// fileEntry is a line written by FilePublisher
+type fileEntry struct {
+	Time  time.Time       `json:"time"`
+	Topic string          `json:"topic"`
+	Event json.RawMessage `json:"event"`
+}
+
+// FilePublisher writes each event as a line of JSON to stdout or a file.
+// Files are rotated once they reach MaxSize or MaxAge; rotated files are
+// renamed to <path>.<time>, optionally compressed with gzip and removed
+// once there are more than MaxBackups of them.
+type FilePublisher struct {
+	sync.Mutex
+
+	cfg config.FileConfig
+
+	w      io.Writer
+	file   *os.File
+	size   int64
+	opened time.Time
+
+	// rotated files being compressed; compressing and pruning rotated
+	// files is serialized by rotated
+	wg      sync.WaitGroup
+	rotated sync.Mutex
+}
+
+// NewFilePublisher opens the file events are written to, appending to it if
+// it exists, or stdout if the path is empty or "-"
+func NewFilePublisher(cfg config.FileConfig) (*FilePublisher, error) {
+	p := &FilePublisher{cfg: cfg}
+
+	if p.stdout() {
+		p.w = os.Stdout
+		return p, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0755); err != nil {
+		return nil, fmt.Errorf("error creating directory: %s", err)
+	}
+	if err := p.open(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *FilePublisher) stdout() bool {
+	return p.cfg.Path == "" || p.cfg.Path == "-"
+}
+
+// Publish ...
+func (p *FilePublisher) Publish(topic string, payload []byte) error {
+	data, err := json.Marshal(&fileEntry{
+		Time:  time.Now(),
+		Topic: topic,
+		Event: payload,
+	})
+	if err != nil {
+		return fmt.Errorf("error encoding event: %s", err)
+	}
+	data = append(data, '\n')
+
+	p.Lock()
+	defer p.Unlock()
+
+	if p.w == nil {
+		return fmt.Errorf("error writing event: publisher closed")
+	}
+
+	if p.file != nil && p.expired(int64(len(data))) {
+		if err := p.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := p.w.Write(data)
+	p.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("error writing event: %s", err)
+	}
+
+	return nil
+}
+
+// Close closes the file and waits for rotated files to be compressed
+func (p *FilePublisher) Close() error {
+	p.Lock()
+	defer p.Unlock()
+
+	p.w = nil
+	p.wg.Wait()
+
+	if p.file != nil {
+		err := p.file.Close()
+		p.file = nil
+		return err
+	}
+	return nil
+}
+
+// expired reports whether the file must be rotated before writing n bytes
+func (p *FilePublisher) expired(n int64) bool {
+	if p.cfg.MaxSize > 0 && p.size > 0 && p.size+n > p.cfg.MaxSize {
+		return true
+	}
+	if p.cfg.MaxAge.Duration > 0 && time.Since(p.opened) >= p.cfg.MaxAge.Duration {
+		return true
+	}
+	return false
+}
+
+func (p *FilePublisher) open() error {
+	f, err := os.OpenFile(p.cfg.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening file: %s", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("error opening file: %s", err)
+	}
+
+	p.w, p.file, p.size, p.opened = f, f, fi.Size(), time.Now()
+	return nil
+}
+
+// rotate renames the current file and starts a new one
+func (p *FilePublisher) rotate() error {
+	if err := p.file.Close(); err != nil {
+		log.Errorf("error closing %s: %s", p.cfg.Path, err)
+	}
+
+	backup := fmt.Sprintf("%s.%s", p.cfg.Path, time.Now().Format(backupTimeFormat))
+	if err := os.Rename(p.cfg.Path, backup); err != nil {
+		log.Errorf("error rotating %s: %s", p.cfg.Path, err)
+		backup = ""
+	}
+
+	if err := p.open(); err != nil {
+		p.w, p.file = nil, nil
+		return err
+	}
+
+	if backup == "" {
+		return nil
+	}
+
+	if !p.cfg.Compress {
+		p.rotated.Lock()
+		p.prune()
+		p.rotated.Unlock()
+		return nil
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		p.rotated.Lock()
+		defer p.rotated.Unlock()
+
+		if err := compressFile(backup); err != nil {
+			log.Errorf("error compressing %s: %s", backup, err)
+		}
+		p.prune()
+	}()
+
+	return nil
+}
+
+// prune removes the oldest rotated files beyond MaxBackups
+func (p *FilePublisher) prune() {
+	if p.cfg.MaxBackups <= 0 {
+		return
+	}
+
+	dir, base := filepath.Split(p.cfg.Path)
+	if dir == "" {
+		dir = "."
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		log.Errorf("error listing rotated files: %s", err)
+		return
+	}
+
+	var backups []string
+	for _, fi := range files {
+		name := fi.Name()
+		if !strings.HasPrefix(name, base+".") {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, base+"."), ".gz")
+		if _, err := time.Parse(backupTimeFormat, stamp); err != nil {
+			continue
+		}
+		backups = append(backups, name)
+	}
+	sort.Strings(backups)
+
+	for i := 0; i < len(backups)-p.cfg.MaxBackups; i++ {
+		if err := os.Remove(filepath.Join(dir, backups[i])); err != nil && !os.IsNotExist(err) {
+			log.Errorf("error removing rotated file: %s", err)
+		}
+	}
+}
+
+// compressFile replaces a file with a gzip compressed copy named <path>.gz
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		out.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		out.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	return os.Remove(path)
+}
@@ -0,0 +1,128 @@
+package collector
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prologic/autodock/config"
+)
+
+func TestFilePublisher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "autodock-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "events.jsonl")
+	p, err := NewFilePublisher(config.FileConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.Publish("container.die.web_1", []byte(`{"Type":"container","Action":"die"}`))
+	p.Publish("container.start.web_1", []byte(`{"Type":"container","Action":"start"}`))
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var entries []fileEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e fileEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 lines got %d", len(entries))
+	}
+	if entries[0].Topic != "container.die.web_1" || string(entries[0].Event) != `{"Type":"container","Action":"die"}` {
+		t.Errorf("unexpected entry %s %s", entries[0].Topic, entries[0].Event)
+	}
+	if entries[0].Time.IsZero() {
+		t.Error("expected time to be set")
+	}
+}
+
+func TestFilePublisherRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "autodock-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "events.jsonl")
+	p, err := NewFilePublisher(config.FileConfig{
+		Path:       path,
+		MaxSize:    1,
+		MaxBackups: 2,
+		Compress:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// each event is written to a new file
+	for i := 0; i < 4; i++ {
+		if err := p.Publish("container.start.web_1", []byte(`{}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var backups []string
+	for _, fi := range files {
+		if fi.Name() != "events.jsonl" {
+			backups = append(backups, fi.Name())
+		}
+	}
+	if len(backups) != 2 {
+		t.Fatalf("expected 2 rotated files got %v", backups)
+	}
+
+	for _, name := range backups {
+		if !strings.HasSuffix(name, ".gz") {
+			t.Errorf("expected %s to be compressed", name)
+			continue
+		}
+
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(gz)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Count(string(data), "\n") != 1 {
+			t.Errorf("expected one line in %s got %q", name, data)
+		}
+	}
+}
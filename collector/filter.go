@@ -0,0 +1,190 @@
+package collector
+
+import (
+	"regexp"
+	"strings"
+
+	etypes "github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+
+	"github.com/prologic/autodock/config"
+)
+
+// glob is a pattern where * matches any sequence of characters and ?
+// matches any single character
+type glob struct {
+	pattern string
+	re      *regexp.Regexp
+}
+
+func newGlob(pattern string) *glob {
+	if pattern == "" {
+		return nil
+	}
+
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.Replace(expr, `\*`, ".*", -1)
+	expr = strings.Replace(expr, `\?`, ".", -1)
+
+	return &glob{pattern: pattern, re: regexp.MustCompile("^" + expr + "$")}
+}
+
+// literal reports whether the pattern contains no wildcards
+func (g *glob) literal() bool {
+	return !strings.ContainsAny(g.pattern, "*?")
+}
+
+func (g *glob) Match(s string) bool {
+	return g == nil || g.re.MatchString(s)
+}
+
+type filterRule struct {
+	config.FilterRule
+
+	typ, action, image, name *glob
+}
+
+func newFilterRule(rule config.FilterRule) *filterRule {
+	return &filterRule{
+		FilterRule: rule,
+
+		typ:    newGlob(rule.Type),
+		action: newGlob(rule.Action),
+		image:  newGlob(rule.Image),
+		name:   newGlob(rule.Name),
+	}
+}
+
+func (r *filterRule) Match(msg etypes.Message) bool {
+	attrs := msg.Actor.Attributes
+
+	if !r.typ.Match(msg.Type) {
+		return false
+	}
+
+	// exec actions include the command, e.g. "exec_start: /bin/sh -c ..."
+	action := strings.SplitN(msg.Action, ":", 2)[0]
+	if !r.action.Match(msg.Action) && !r.action.Match(action) {
+		return false
+	}
+
+	if r.image != nil {
+		image := attrs["image"]
+		if image == "" {
+			image = msg.From
+		}
+		if !r.image.Match(image) {
+			return false
+		}
+	}
+
+	if !r.name.Match(attrs["name"]) {
+		return false
+	}
+
+	if r.Scope != "" && r.Scope != msg.Scope {
+		return false
+	}
+
+	if r.Label != "" {
+		kv := strings.SplitN(r.Label, "=", 2)
+		value, ok := attrs[kv[0]]
+		if !ok || (len(kv) == 2 && value != kv[1]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Filter selects which events are published as configured by
+// config.FilterConfig
+type Filter struct {
+	include []*filterRule
+	exclude []*filterRule
+}
+
+// NewFilter ...
+func NewFilter(cfg config.FilterConfig) *Filter {
+	f := &Filter{}
+
+	for _, rule := range cfg.Include {
+		f.include = append(f.include, newFilterRule(rule))
+	}
+
+	for _, rule := range cfg.Exclude {
+		f.exclude = append(f.exclude, newFilterRule(rule))
+	}
+
+	return f
+}
+
+// Match returns true if the event should be published
+func (f *Filter) Match(msg etypes.Message) bool {
+	for _, rule := range f.exclude {
+		if rule.Match(msg) {
+			return false
+		}
+	}
+
+	if len(f.include) == 0 {
+		return true
+	}
+
+	for _, rule := range f.include {
+		if rule.Match(msg) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Args returns filters for the Docker events API that select a superset of
+// the events matched by the include rules, so that the daemon does not send
+// events that would be discarded anyway.
+//
+// Docker ORs values of the same filter and ANDs different filters, so a
+// filter is only used if every include rule has a literal value for it.
+func (f *Filter) Args() filters.Args {
+	args := filters.NewArgs()
+
+	if len(f.include) == 0 {
+		return args
+	}
+
+	allContainers := true
+	for _, rule := range f.include {
+		if rule.Type != etypes.ContainerEventType {
+			allContainers = false
+		}
+	}
+
+	add := func(key string, value func(r *filterRule) string, literal func(r *filterRule) bool) {
+		for _, rule := range f.include {
+			if value(rule) == "" || !literal(rule) {
+				return
+			}
+		}
+		for _, rule := range f.include {
+			args.Add(key, value(rule))
+		}
+	}
+
+	always := func(*filterRule) bool { return true }
+
+	add("type", func(r *filterRule) string { return r.Type }, func(r *filterRule) bool { return r.typ.literal() })
+	add("event", func(r *filterRule) string { return r.Action }, func(r *filterRule) bool {
+		return r.action.literal() && !strings.Contains(r.Action, ":")
+	})
+	add("label", func(r *filterRule) string { return r.Label }, always)
+	add("scope", func(r *filterRule) string { return r.Scope }, always)
+
+	// the container and image filters also match other types of events
+	if allContainers {
+		add("container", func(r *filterRule) string { return r.Name }, func(r *filterRule) bool { return r.name.literal() })
+		add("image", func(r *filterRule) string { return r.Image }, func(r *filterRule) bool { return r.image.literal() })
+	}
+
+	return args
+}
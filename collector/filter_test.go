@@ -0,0 +1,112 @@
+package collector
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	etypes "github.com/docker/docker/api/types/events"
+
+	"github.com/prologic/autodock/config"
+)
+
+func TestFilterMatch(t *testing.T) {
+	f := NewFilter(config.FilterConfig{
+		Include: []config.FilterRule{
+			{Type: "container", Label: "com.docker.compose.project=web"},
+			{Type: "service"},
+		},
+		Exclude: []config.FilterRule{
+			{Action: "exec_*"},
+			{Type: "container", Name: "*-healthcheck"},
+		},
+	})
+
+	container := func(action, name string) etypes.Message {
+		return etypes.Message{
+			Type:   "container",
+			Action: action,
+			Actor: etypes.Actor{
+				ID: "abc",
+				Attributes: map[string]string{
+					"name":                       name,
+					"image":                      "nginx:latest",
+					"com.docker.compose.project": "web",
+				},
+			},
+		}
+	}
+
+	testCases := []struct {
+		msg      etypes.Message
+		expected bool
+	}{
+		{container("start", "web_nginx_1"), true},
+		{container("exec_create: /bin/sh -c true", "web_nginx_1"), false},
+		{container("die", "nginx-healthcheck"), false},
+		{etypes.Message{Type: "container", Action: "start"}, false},
+		{etypes.Message{Type: "service", Action: "update"}, true},
+		{etypes.Message{Type: "network", Action: "connect"}, false},
+	}
+
+	for _, testCase := range testCases {
+		if actual := f.Match(testCase.msg); actual != testCase.expected {
+			t.Errorf("%s %s: expected %v; got %v", testCase.msg.Type, testCase.msg.Action, testCase.expected, actual)
+		}
+	}
+
+	if !NewFilter(config.FilterConfig{}).Match(etypes.Message{Type: "volume"}) {
+		t.Error("expected empty filter to match everything")
+	}
+}
+
+func TestFilterArgs(t *testing.T) {
+	testCases := []struct {
+		include  []config.FilterRule
+		expected map[string][]string
+	}{
+		{
+			nil,
+			map[string][]string{},
+		},
+		{
+			[]config.FilterRule{{Type: "container"}, {Type: "service"}},
+			map[string][]string{"type": {"container", "service"}},
+		},
+		{
+			// a glob cannot be passed to Docker
+			[]config.FilterRule{{Type: "container", Action: "die"}, {Type: "container", Action: "health_*"}},
+			map[string][]string{"type": {"container"}},
+		},
+		{
+			// not every rule has an action so none can be passed to Docker
+			[]config.FilterRule{{Type: "container", Action: "die", Name: "web"}, {Type: "network"}},
+			map[string][]string{"type": {"container", "network"}},
+		},
+		{
+			[]config.FilterRule{{Type: "container", Name: "web", Image: "nginx", Scope: "local"}},
+			map[string][]string{
+				"type":      {"container"},
+				"container": {"web"},
+				"image":     {"nginx"},
+				"scope":     {"local"},
+			},
+		},
+	}
+
+	for i, testCase := range testCases {
+		args := NewFilter(config.FilterConfig{Include: testCase.include}).Args()
+
+		actual := make(map[string][]string)
+		for _, key := range []string{"type", "event", "label", "scope", "container", "image"} {
+			if values := args.Get(key); len(values) > 0 {
+				sort.Strings(values)
+				actual[key] = values
+			}
+		}
+
+		if !reflect.DeepEqual(actual, testCase.expected) {
+			t.Errorf("case %d: expected %v; got %v", i, testCase.expected, actual)
+		}
+	}
+}
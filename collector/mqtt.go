@@ -0,0 +1,102 @@
+package collector
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/prologic/autodock/config"
+	"github.com/prologic/autodock/mqtt"
+)
+
+// MQTTPublisher publishes events to an MQTT broker on their topic mapped
+// under a prefix, e.g. autodock/container/die/web_1. The connection is made
+// with the first event published and remade after it is lost; events
+// published while it is being remade are dropped with an error.
+type MQTTPublisher struct {
+	sync.Mutex
+
+	url  string
+	cfg  config.MQTTConfig
+	opts mqtt.Options
+
+	client mqtt.Client
+}
+
+// NewMQTTPublisher ...
+func NewMQTTPublisher(url string, cfg config.MQTTConfig) *MQTTPublisher {
+	if cfg.Prefix == "" {
+		cfg.Prefix = mqtt.DefaultPrefix
+	}
+
+	clientID := cfg.ClientID
+	if clientID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = "localhost"
+		}
+		clientID = fmt.Sprintf("autodock-%s", hostname)
+	}
+
+	return &MQTTPublisher{
+		url: url,
+		cfg: cfg,
+		opts: mqtt.Options{
+			ClientID:  clientID,
+			Username:  cfg.Username,
+			Password:  cfg.Password,
+			KeepAlive: cfg.KeepAlive.Duration,
+		},
+	}
+}
+
+// Publish ...
+func (p *MQTTPublisher) Publish(topic string, payload []byte) error {
+	client, err := p.connect()
+	if err != nil {
+		return err
+	}
+	if !client.IsConnectionOpen() {
+		return fmt.Errorf("error publishing to mqtt broker: not connected")
+	}
+
+	token := client.Publish(mqtt.Topic(p.cfg.Prefix, topic), byte(p.cfg.QoS), p.cfg.Retain, payload)
+	if err := mqtt.Wait(token, mqtt.DefaultTimeout); err != nil {
+		return fmt.Errorf("error publishing to mqtt broker: %s", err)
+	}
+	return nil
+}
+
+// connect returns the client of the broker, connecting if necessary
+func (p *MQTTPublisher) connect() (mqtt.Client, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.client != nil {
+		return p.client, nil
+	}
+
+	client, err := mqtt.NewClient(p.url, p.opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := mqtt.Wait(client.Connect(), mqtt.DefaultTimeout); err != nil {
+		client.Disconnect(0)
+		return nil, fmt.Errorf("error connecting to mqtt broker: %s", err)
+	}
+	p.client = client
+
+	return client, nil
+}
+
+// Close disconnects from the broker
+func (p *MQTTPublisher) Close() error {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.client != nil {
+		p.client.Disconnect(250)
+		p.client = nil
+	}
+	return nil
+}
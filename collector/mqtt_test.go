@@ -0,0 +1,44 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/prologic/autodock/config"
+	"github.com/prologic/autodock/mqtt/mqtttest"
+)
+
+func TestMQTTPublisher(t *testing.T) {
+	broker := mqtttest.NewServer()
+	defer broker.Close()
+
+	p := NewMQTTPublisher(broker.URL, config.MQTTConfig{Prefix: "edge/host1", QoS: 1, Retain: true})
+	defer p.Close()
+
+	if err := p.Publish("container.die.web_1", []byte(`{"n":1}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	// reconnects after losing the connection
+	connects := broker.Connects()
+	broker.CloseClientConnections()
+	waitFor(t, func() bool {
+		return broker.Connects() > connects && p.client.IsConnectionOpen()
+	})
+
+	if err := p.Publish("container.die.web_1", []byte(`{"n":2}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := broker.Messages()
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 messages got %d", len(messages))
+	}
+	for _, m := range messages {
+		if m.Topic != "edge/host1/container/die/web_1" || m.QoS != 1 || !m.Retain {
+			t.Errorf("unexpected message on %s qos=%d retain=%t", m.Topic, m.QoS, m.Retain)
+		}
+	}
+	if m := broker.Retained("edge/host1/container/die/web_1"); m == nil || string(m.Payload) != `{"n":2}` {
+		t.Errorf("expected last event to be retained")
+	}
+}
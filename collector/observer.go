@@ -0,0 +1,52 @@
+package collector
+
+import (
+	"fmt"
+	"time"
+)
+
+// Observer is told about events as they are collected and published, e.g.
+// to export metrics. Its methods may be called concurrently.
+type Observer interface {
+	// EventReceived is called with each event received from Docker, with
+	// the action's arguments, e.g. of "exec_start: sh", left out
+	EventReceived(typ, action string, t time.Time)
+
+	// EventProcessed is called once an event has passed through the
+	// pipeline and been published
+	EventProcessed()
+
+	// EventPublished is called each time the named publisher of a
+	// FanoutPublisher publishes an event, with how long it took
+	EventPublished(publisher string, d time.Duration, err error)
+
+	// EventDropped is called each time the named publisher of a
+	// FanoutPublisher drops an event because its buffer is full
+	EventDropped(publisher string)
+
+	// Reconnected is called each time the collector is connected to the
+	// Docker event stream again after connecting or the stream failed
+	Reconnected()
+}
+
+type nopObserver struct{}
+
+func (nopObserver) EventReceived(typ, action string, t time.Time)               {}
+func (nopObserver) EventProcessed()                                             {}
+func (nopObserver) EventPublished(publisher string, d time.Duration, err error) {}
+func (nopObserver) EventDropped(publisher string)                               {}
+func (nopObserver) Reconnected()                                                {}
+
+// Observe sets the observer told about events collected and published.
+// Observe must be called before Start.
+func (c *Collector) Observe(observer Observer) error {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.done != nil {
+		return fmt.Errorf("error setting observer: collector already started")
+	}
+
+	c.observer = observer
+	return nil
+}
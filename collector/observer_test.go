@@ -0,0 +1,183 @@
+package collector
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	etypes "github.com/docker/docker/api/types/events"
+)
+
+// recordingObserver records what it is told about events
+type recordingObserver struct {
+	sync.Mutex
+	received   []string
+	processed  int
+	published  map[string]int
+	errors     map[string]int
+	dropped    map[string]int
+	reconnects int
+}
+
+func newRecordingObserver() *recordingObserver {
+	return &recordingObserver{
+		published: make(map[string]int),
+		errors:    make(map[string]int),
+		dropped:   make(map[string]int),
+	}
+}
+
+func (o *recordingObserver) EventReceived(typ, action string, t time.Time) {
+	o.Lock()
+	defer o.Unlock()
+	o.received = append(o.received, typ+"."+action)
+}
+
+func (o *recordingObserver) EventProcessed() {
+	o.Lock()
+	defer o.Unlock()
+	o.processed++
+}
+
+func (o *recordingObserver) EventPublished(publisher string, d time.Duration, err error) {
+	o.Lock()
+	defer o.Unlock()
+	o.published[publisher]++
+	if err != nil {
+		o.errors[publisher]++
+	}
+}
+
+func (o *recordingObserver) EventDropped(publisher string) {
+	o.Lock()
+	defer o.Unlock()
+	o.dropped[publisher]++
+}
+
+func (o *recordingObserver) Reconnected() {
+	o.Lock()
+	defer o.Unlock()
+	o.reconnects++
+}
+
+func TestCollectorObserver(t *testing.T) {
+	d := newFakeDocker()
+	defer d.Close()
+	d.streams = [][]etypes.Message{
+		{{Type: "container", Action: "start", Actor: etypes.Actor{ID: "a"}, TimeNano: 1}},
+		// the first event is replayed after reconnecting and discarded
+		{
+			{Type: "container", Action: "start", Actor: etypes.Actor{ID: "a"}, TimeNano: 1},
+			{Type: "container", Action: "exec_start: /bin/sh -c healthcheck", Actor: etypes.Actor{ID: "a"}, TimeNano: 2},
+			{Type: "container", Action: "die", Actor: etypes.Actor{ID: "a"}, TimeNano: 3},
+		},
+	}
+
+	publisher := &recordingPublisher{}
+	c := newTestCollector(t, d, publisher)
+	c.cfg.Collector.Backoff.Min.Duration = time.Millisecond
+
+	observer := newRecordingObserver()
+	if err := c.Observe(observer); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Observe(observer); err == nil {
+		t.Error("expected error setting observer of started collector")
+	}
+
+	waitFor(t, func() bool {
+		observer.Lock()
+		defer observer.Unlock()
+		return len(observer.received) == 3
+	})
+	if err := c.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	observer.Lock()
+	defer observer.Unlock()
+
+	received := []string{"container.start", "container.exec_start", "container.die"}
+	if !reflect.DeepEqual(observer.received, received) {
+		t.Errorf("expected events received %v got %v", received, observer.received)
+	}
+	if observer.reconnects != 1 {
+		t.Errorf("expected 1 reconnect got %d", observer.reconnects)
+	}
+	// the collector's own state changes are processed too
+	publisher.Lock()
+	n := len(publisher.topics)
+	publisher.Unlock()
+	if observer.processed != n {
+		t.Errorf("expected %d events processed got %d", n, observer.processed)
+	}
+}
+
+func TestFanoutPublisherObserver(t *testing.T) {
+	observer := newRecordingObserver()
+
+	f := NewFanoutPublisher()
+	f.Observe(observer)
+	f.Add("ok", &recordingPublisher{}, 10)
+	f.Add("failing", failingPublisher{}, 10)
+
+	for i := 0; i < 3; i++ {
+		if err := f.Publish("container.start.web_1", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	observer.Lock()
+	defer observer.Unlock()
+
+	if observer.published["ok"] != 3 || observer.errors["ok"] != 0 {
+		t.Errorf("expected 3 events published by ok got %d (%d errors)", observer.published["ok"], observer.errors["ok"])
+	}
+	if observer.errors["failing"] != 3 {
+		t.Errorf("expected 3 errors for failing got %d", observer.errors["failing"])
+	}
+}
+
+func TestFanoutPublisherObserverDropped(t *testing.T) {
+	observer := newRecordingObserver()
+	slow := &blockingPublisher{unblock: make(chan struct{})}
+
+	f := NewFanoutPublisher()
+	f.Observe(observer)
+	f.Add("ok", &recordingPublisher{}, 10)
+	f.Add("slow", slow, 1)
+
+	var errs int
+	for i := 0; i < 5; i++ {
+		if err := f.Publish("container.start.web_1", nil); err != nil {
+			errs++
+		}
+	}
+
+	close(slow.unblock)
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	observer.Lock()
+	defer observer.Unlock()
+
+	if errs == 0 {
+		t.Fatal("expected events to be dropped for the slow publisher")
+	}
+	if observer.dropped["slow"] != errs {
+		t.Errorf("expected %d events dropped by slow got %d", errs, observer.dropped["slow"])
+	}
+	if observer.dropped["ok"] != 0 {
+		t.Errorf("expected no events dropped by ok got %d", observer.dropped["ok"])
+	}
+}
@@ -0,0 +1,102 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/prologic/autodock/events"
+)
+
+// Use adds middleware to the pipeline events pass through before being
+// published. Events are filtered and enriched before reaching middleware
+// added with Use, in the order added. Use must be called before Start.
+func (c *Collector) Use(middleware ...events.Middleware) error {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.done != nil {
+		return fmt.Errorf("error adding middleware: collector already started")
+	}
+
+	c.middleware = append(c.middleware, middleware...)
+	return nil
+}
+
+// Handle adds handlers called in-process with each event after it has
+// been published. Handle must be called before Start.
+func (c *Collector) Handle(handlers ...events.Handler) error {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.done != nil {
+		return fmt.Errorf("error adding handler: collector already started")
+	}
+
+	c.handlers = append(c.handlers, handlers...)
+	return nil
+}
+
+// pipeline returns the handler each event is passed to: the filter,
+// enrichment and any middleware added with Use, then publishing
+func (c *Collector) pipeline() events.Handler {
+	middleware := []events.Middleware{c.filterEvents, c.enrichEvents}
+	middleware = append(middleware, c.middleware...)
+
+	return events.Chain(events.HandlerFunc(c.publish), middleware...)
+}
+
+// filterEvents drops Docker events not selected by the filter. Events
+// generated by autodock are never filtered.
+func (c *Collector) filterEvents(next events.Handler) events.Handler {
+	return events.HandlerFunc(func(e *events.Message) error {
+		c.Lock()
+		filter := c.filter
+		c.Unlock()
+
+		if e.Type != events.AutodockEventType && !filter.Match(e.Message) {
+			return events.ErrDrop
+		}
+		return next.Handle(e)
+	})
+}
+
+func (c *Collector) enrichEvents(next events.Handler) events.Handler {
+	return events.HandlerFunc(func(e *events.Message) error {
+		c.enricher.Enrich(e)
+		return next.Handle(e)
+	})
+}
+
+// publish publishes an event on its topic and then passes it to the
+// handlers added with Handle
+func (c *Collector) publish(e *events.Message) error {
+	log.Debugf(
+		"event received: id=%s, type=%s status=%s action=%s",
+		e.ID, e.Type, e.Status, e.Action,
+	)
+
+	if e.ID == "" && e.Type == "" {
+		return events.ErrDrop
+	}
+
+	topic := events.Topic(e)
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("error encoding event: %s", err)
+	}
+
+	if err := c.publisher.Publish(topic, payload); err != nil {
+		log.Errorf("error publishing event %s: %s", topic, err)
+	}
+	c.observer.EventProcessed()
+
+	for _, h := range c.handlers {
+		if err := h.Handle(e); err != nil && err != events.ErrDrop {
+			log.Errorf("error handling event %s: %s", topic, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,216 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/prologic/msgbus"
+	msgbusclient "github.com/prologic/msgbus/client"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/prologic/autodock/events"
+)
+
+// Publisher ...
+type Publisher interface {
+	Publish(topic string, payload []byte) error
+}
+
+// Publishers publishes to each of a set of publishers in turn
+type Publishers []Publisher
+
+// Publish ...
+func (ps Publishers) Publish(topic string, payload []byte) error {
+	var errs []string
+
+	for _, p := range ps {
+		if err := p.Publish(topic, payload); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// Close closes each publisher that needs to be closed, e.g. to stop
+// background delivery
+func (ps Publishers) Close() error {
+	var errs []string
+
+	for _, p := range ps {
+		if c, ok := p.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// TopicFilterPublisher publishes only events on topics matching any of a
+// set of patterns
+type TopicFilterPublisher struct {
+	publisher Publisher
+	patterns  []string
+}
+
+// NewTopicFilterPublisher ...
+func NewTopicFilterPublisher(publisher Publisher, patterns []string) *TopicFilterPublisher {
+	return &TopicFilterPublisher{publisher, patterns}
+}
+
+// Publish ...
+func (p *TopicFilterPublisher) Publish(topic string, payload []byte) error {
+	for _, pattern := range p.patterns {
+		if events.MatchTopicOrParent(pattern, topic) {
+			return p.publisher.Publish(topic, payload)
+		}
+	}
+	return nil
+}
+
+// Close ...
+func (p *TopicFilterPublisher) Close() error {
+	if c, ok := p.publisher.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// SwappablePublisher is a Publisher whose underlying Publisher can be
+// replaced at runtime, e.g. when the configuration is reloaded
+type SwappablePublisher struct {
+	sync.RWMutex
+	publisher Publisher
+}
+
+// NewSwappablePublisher ...
+func NewSwappablePublisher(publisher Publisher) *SwappablePublisher {
+	return &SwappablePublisher{publisher: publisher}
+}
+
+// Swap replaces the underlying Publisher and then closes the previous one
+// if it needs to be closed. Events are published to the new Publisher
+// while the previous one is closing.
+func (p *SwappablePublisher) Swap(publisher Publisher) {
+	p.Lock()
+	old := p.publisher
+	p.publisher = publisher
+	p.Unlock()
+
+	if c, ok := old.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			log.Errorf("error closing publisher: %s", err)
+		}
+	}
+}
+
+// Close closes the underlying Publisher if it needs to be closed
+func (p *SwappablePublisher) Close() error {
+	p.RLock()
+	defer p.RUnlock()
+
+	if c, ok := p.publisher.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Publish ...
+func (p *SwappablePublisher) Publish(topic string, payload []byte) error {
+	p.RLock()
+	publisher := p.publisher
+	p.RUnlock()
+
+	return publisher.Publish(topic, payload)
+}
+
+// CloudEventsPublisher wraps events as CloudEvents before publishing them
+type CloudEventsPublisher struct {
+	publisher Publisher
+	source    string
+}
+
+// NewCloudEventsPublisher ...
+func NewCloudEventsPublisher(publisher Publisher, source string) *CloudEventsPublisher {
+	return &CloudEventsPublisher{publisher, source}
+}
+
+// Close ...
+func (p *CloudEventsPublisher) Close() error {
+	if c, ok := p.publisher.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Publish ...
+func (p *CloudEventsPublisher) Publish(topic string, payload []byte) error {
+	e, err := events.NewCloudEvent(p.source, topic, payload)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("error encoding cloudevent: %s", err)
+	}
+
+	return p.publisher.Publish(topic, data)
+}
+
+// MessageBusLocalPublisher publishes to the local message bus. As the
+// message bus has no wildcard subscriptions each event is published on its
+// topic and each of its parents so that e.g. subscribers to container
+// receive container.die.web_1 events.
+type MessageBusLocalPublisher struct {
+	msgbus *msgbus.MessageBus
+}
+
+// NewMessageBusLocalPublisher ...
+func NewMessageBusLocalPublisher(msgbus *msgbus.MessageBus) *MessageBusLocalPublisher {
+	return &MessageBusLocalPublisher{msgbus}
+}
+
+// Publish ...
+func (p *MessageBusLocalPublisher) Publish(topic string, payload []byte) error {
+	for _, t := range events.Topics(topic) {
+		message := p.msgbus.NewMessage(p.msgbus.NewTopic(t), payload)
+		p.msgbus.Put(message)
+	}
+	return nil
+}
+
+// MessageBusRemotePublisher publishes to a remote message bus on each
+// level of an event's topic like MessageBusLocalPublisher
+type MessageBusRemotePublisher struct {
+	client *msgbusclient.Client
+}
+
+// NewMessageBusRemotePublisher ...
+func NewMessageBusRemotePublisher(url string) *MessageBusRemotePublisher {
+	client := msgbusclient.NewClient(url, nil)
+	return &MessageBusRemotePublisher{client}
+}
+
+// Publish ...
+func (p *MessageBusRemotePublisher) Publish(topic string, payload []byte) error {
+	for _, t := range events.Topics(topic) {
+		if err := p.client.Publish(t, string(payload)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const queueExt = ".json"
+
+// queueLocks holds a lock for each queue directory in use so that a queue
+// is only opened once it has been closed by its previous user, e.g. a
+// publisher being replaced on reload
+var queueLocks = struct {
+	sync.Mutex
+	dirs map[string]*sync.Mutex
+}{dirs: make(map[string]*sync.Mutex)}
+
+func lockQueueDir(dir string) *sync.Mutex {
+	queueLocks.Lock()
+	l, ok := queueLocks.dirs[dir]
+	if !ok {
+		l = &sync.Mutex{}
+		queueLocks.dirs[dir] = l
+	}
+	queueLocks.Unlock()
+
+	l.Lock()
+	return l
+}
+
+// queueEntry is an event waiting to be delivered
+type queueEntry struct {
+	Seq      uint64          `json:"seq"`
+	Topic    string          `json:"topic"`
+	Payload  json.RawMessage `json:"payload"`
+	Attempts int             `json:"attempts"`
+	Created  time.Time       `json:"created"`
+}
+
+// diskQueue is a bounded FIFO queue of events stored as one file per
+// event so that undelivered events survive restarts
+type diskQueue struct {
+	sync.Mutex
+
+	dir  string
+	size int
+	lock *sync.Mutex
+
+	seqs []uint64
+	last uint64
+}
+
+// openDiskQueue opens the queue in dir, waiting for it to be closed if it
+// is already open
+func openDiskQueue(dir string, size int) (*diskQueue, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating queue: %s", err)
+	}
+
+	lock := lockQueueDir(dir)
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		lock.Unlock()
+		return nil, fmt.Errorf("error reading queue: %s", err)
+	}
+
+	q := &diskQueue{dir: dir, size: size, lock: lock}
+	for _, fi := range files {
+		name := fi.Name()
+		if !strings.HasSuffix(name, queueExt) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, queueExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		q.seqs = append(q.seqs, seq)
+		if seq > q.last {
+			q.last = seq
+		}
+	}
+	sort.Slice(q.seqs, func(a, b int) bool { return q.seqs[a] < q.seqs[b] })
+
+	return q, nil
+}
+
+// Close releases the queue so that it may be opened again
+func (q *diskQueue) Close() {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.lock != nil {
+		q.lock.Unlock()
+		q.lock = nil
+	}
+}
+
+func (q *diskQueue) path(seq uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", seq, queueExt))
+}
+
+// Len returns the number of queued events
+func (q *diskQueue) Len() int {
+	q.Lock()
+	defer q.Unlock()
+
+	return len(q.seqs)
+}
+
+// Push queues an event; it fails if the queue is full
+func (q *diskQueue) Push(topic string, payload []byte) error {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.size > 0 && len(q.seqs) >= q.size {
+		return fmt.Errorf("queue full (%d events)", len(q.seqs))
+	}
+
+	e := &queueEntry{
+		Seq:     q.last + 1,
+		Topic:   topic,
+		Payload: payload,
+		Created: time.Now(),
+	}
+	if err := q.write(e); err != nil {
+		return err
+	}
+
+	q.last = e.Seq
+	q.seqs = append(q.seqs, e.Seq)
+
+	return nil
+}
+
+// Peek returns the oldest queued event or nil if the queue is empty
+func (q *diskQueue) Peek() (*queueEntry, error) {
+	q.Lock()
+	defer q.Unlock()
+
+	for len(q.seqs) > 0 {
+		seq := q.seqs[0]
+
+		data, err := ioutil.ReadFile(q.path(seq))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("error reading queued event %d: %s", seq, err)
+		}
+		if err == nil {
+			var e queueEntry
+			if err := json.Unmarshal(data, &e); err == nil {
+				return &e, nil
+			}
+
+			// a corrupt entry can never be delivered
+			log.Warnf("discarding corrupt queued event %d in %s", seq, q.dir)
+			os.Remove(q.path(seq))
+		}
+
+		q.seqs = q.seqs[1:]
+	}
+
+	return nil, nil
+}
+
+// Update rewrites a queued event, e.g. to record a failed attempt
+func (q *diskQueue) Update(e *queueEntry) error {
+	q.Lock()
+	defer q.Unlock()
+
+	return q.write(e)
+}
+
+// Remove removes an event from the queue
+func (q *diskQueue) Remove(seq uint64) error {
+	q.Lock()
+	defer q.Unlock()
+
+	for i := range q.seqs {
+		if q.seqs[i] == seq {
+			q.seqs = append(q.seqs[:i], q.seqs[i+1:]...)
+			break
+		}
+	}
+
+	if err := os.Remove(q.path(seq)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing queued event: %s", err)
+	}
+	return nil
+}
+
+// write writes an entry atomically so that a crash never leaves a
+// partially written entry behind
+func (q *diskQueue) write(e *queueEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("error encoding queued event: %s", err)
+	}
+
+	tmp := q.path(e.Seq) + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("error writing queued event: %s", err)
+	}
+	if err := os.Rename(tmp, q.path(e.Seq)); err != nil {
+		return fmt.Errorf("error writing queued event: %s", err)
+	}
+
+	return nil
+}
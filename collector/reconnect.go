@@ -0,0 +1,272 @@
+package collector
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	etypes "github.com/docker/docker/api/types/events"
+	dockerclient "github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/jpillora/backoff"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/prologic/autodock/events"
+)
+
+// State is the state of the collector's connection to Docker
+type State string
+
+const (
+	// StateDisconnected is the initial state before connecting
+	StateDisconnected State = "disconnected"
+	// StateConnected means events are being received from Docker
+	StateConnected State = "connected"
+	// StateReconnecting means the event stream failed and is being retried
+	StateReconnecting State = "reconnecting"
+	// StateDegraded means reconnecting has failed more than the configured
+	// number of retries or failed with an error retrying is unlikely to fix;
+	// the collector keeps retrying at the maximum backoff interval
+	StateDegraded State = "degraded"
+	// StateFailed means the collector gave up reconnecting
+	StateFailed State = "failed"
+)
+
+// errorClass classifies errors from the Docker client
+type errorClass int
+
+const (
+	// errTransient errors such as dropped connections usually resolve
+	errTransient errorClass = iota
+	// errDaemon errors are returned by the daemon, e.g. a swarm without
+	// an elected manager, and usually resolve
+	errDaemon
+	// errPermanent errors such as TLS or authorization failures need
+	// operator intervention
+	errPermanent
+)
+
+func (c errorClass) String() string {
+	switch c {
+	case errTransient:
+		return "transient"
+	case errDaemon:
+		return "daemon"
+	default:
+		return "permanent"
+	}
+}
+
+// causer is implemented by errors wrapped by github.com/pkg/errors which is
+// used by the Docker client
+type causer interface {
+	Cause() error
+}
+
+func classifyError(err error) errorClass {
+	cause := err
+	for {
+		c, ok := cause.(causer)
+		if !ok {
+			break
+		}
+		cause = c.Cause()
+	}
+
+	switch {
+	case dockerclient.IsErrConnectionFailed(err):
+		return errTransient
+	case cause == io.EOF || cause == io.ErrUnexpectedEOF:
+		// the daemon closed the event stream, e.g. when restarting
+		return errTransient
+	case dockerclient.IsErrUnauthorized(err),
+		errdefs.IsUnauthorized(cause),
+		errdefs.IsForbidden(cause),
+		errdefs.IsInvalidParameter(cause),
+		errdefs.IsNotImplemented(cause):
+		return errPermanent
+	}
+
+	switch cause.(type) {
+	case x509.UnknownAuthorityError, x509.CertificateInvalidError, x509.HostnameError,
+		tls.RecordHeaderError:
+		return errPermanent
+	case net.Error:
+		return errTransient
+	}
+
+	return errDaemon
+}
+
+func (c *Collector) newBackoff() *backoff.Backoff {
+	cfg := c.cfg.Collector.Backoff
+	return &backoff.Backoff{
+		Min:    cfg.Min.Duration,
+		Max:    cfg.Max.Duration,
+		Factor: cfg.Factor,
+		Jitter: cfg.Jitter,
+	}
+}
+
+// collect connects and (re)subscribes to the Docker event stream until ctx
+// is done, backing off exponentially between failed attempts.
+func (c *Collector) collect(ctx context.Context) {
+	policy := c.cfg.Collector.Backoff
+	b := c.newBackoff()
+	attempts := 0
+
+	// failed is set once connecting or the event stream failed until the
+	// collector is connected again
+	failed := false
+
+	// resubscribing is set when the stream was ended to apply new filters,
+	// in which case it is resumed without taking another snapshot
+	resubscribing := false
+
+	for {
+		var err error
+		if !resubscribing {
+			err = c.connect(ctx)
+		}
+		resubscribing = false
+
+		if err == nil {
+			started := time.Now()
+			err = c.stream(ctx, func() {
+				c.setState(ctx, StateConnected, nil, attempts)
+				attempts = 0
+				if failed {
+					failed = false
+					c.observer.Reconnected()
+				}
+			})
+
+			// only a stream that stayed up resets the backoff so that a
+			// flapping daemon is not hammered with reconnects
+			if time.Since(started) >= policy.Max.Duration {
+				b.Reset()
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err == errResubscribe {
+			resubscribing = true
+			continue
+		}
+
+		attempts++
+		class := classifyError(err)
+
+		log.WithField("class", class).Errorf(
+			"event stream fail (attempt %d); attempting to reconnect: %s",
+			attempts, err,
+		)
+
+		if class == errPermanent || (policy.MaxRetries > 0 && attempts > policy.MaxRetries) {
+			if policy.Fatal {
+				c.setState(ctx, StateFailed, err, attempts)
+				c.fail(fmt.Errorf("giving up reconnecting to docker after %d attempts: %s", attempts, err))
+				return
+			}
+			c.setState(ctx, StateDegraded, err, attempts)
+		} else {
+			c.setState(ctx, StateReconnecting, err, attempts)
+		}
+		failed = true
+
+		select {
+		case <-time.After(b.Duration()):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// connect checks the daemon is reachable before streaming events, setting
+// the point events are resumed from if not yet known and taking a snapshot
+// of existing objects if enabled
+func (c *Collector) connect(ctx context.Context) error {
+	info, err := c.client.Info(ctx)
+	if err != nil {
+		return err
+	}
+
+	if c.since == 0 {
+		// events are resumed from the daemon's clock should the first
+		// stream fail before any events are received
+		if t, err := time.Parse(time.RFC3339Nano, info.SystemTime); err == nil {
+			c.since = t.UnixNano()
+		}
+	}
+
+	// the snapshot is taken after the resume point is known so that changes
+	// made while listing are replayed by the event stream
+	if c.cfg.Collector.Snapshot {
+		return c.snapshot(ctx, info)
+	}
+	return nil
+}
+
+// setState records a state transition and publishes it as an autodock event
+// so that plugins can react to it.
+func (c *Collector) setState(ctx context.Context, state State, err error, attempts int) {
+	c.Lock()
+	previous := c.state
+	c.state = state
+	c.Unlock()
+
+	if state == previous {
+		return
+	}
+
+	log.Infof("collector state changed: %s -> %s", previous, state)
+
+	now := time.Now()
+	msg := events.NewMessage(etypes.Message{
+		Type:   events.AutodockEventType,
+		Action: string(state),
+		Actor: etypes.Actor{
+			ID: "collector",
+			Attributes: map[string]string{
+				"previous": string(previous),
+				"attempts": strconv.Itoa(attempts),
+			},
+		},
+		Time:     now.Unix(),
+		TimeNano: now.UnixNano(),
+	})
+	if err != nil {
+		msg.Actor.Attributes["error"] = err.Error()
+		msg.Actor.Attributes["class"] = classifyError(err).String()
+	}
+
+	c.send(ctx, msg)
+}
+
+// fail reports a fatal error on the Err channel
+func (c *Collector) fail(err error) {
+	select {
+	case c.errChan <- err:
+	default:
+	}
+}
+
+// State returns the current state of the collector
+func (c *Collector) State() State {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.state
+}
+
+// Err returns a channel on which the collector reports a fatal error if it
+// gives up reconnecting to Docker
+func (c *Collector) Err() <-chan error {
+	return c.errChan
+}
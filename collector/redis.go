@@ -0,0 +1,77 @@
+package collector
+
+import (
+	"sync"
+
+	"github.com/prologic/autodock/config"
+	"github.com/prologic/autodock/redis"
+)
+
+const defaultRedisMaxLen = 100000
+
+// RedisPublisher adds each event to a Redis stream as an entry with the
+// fields topic and payload, so that plugins can consume events with
+// consumer groups. The connection is made with the first event published
+// and remade after it fails.
+type RedisPublisher struct {
+	sync.Mutex
+
+	url    string
+	stream string
+	maxLen int64
+
+	conn redis.Conn
+}
+
+// NewRedisPublisher ...
+func NewRedisPublisher(url string, cfg config.RedisConfig) *RedisPublisher {
+	if cfg.Stream == "" {
+		cfg.Stream = redis.DefaultStream
+	}
+	if cfg.MaxLen == 0 {
+		cfg.MaxLen = defaultRedisMaxLen
+	}
+
+	return &RedisPublisher{url: url, stream: cfg.Stream, maxLen: cfg.MaxLen}
+}
+
+// Publish ...
+func (p *RedisPublisher) Publish(topic string, payload []byte) error {
+	conn, err := p.connect()
+	if err != nil {
+		return err
+	}
+
+	_, err = redis.XAdd(conn, p.stream, p.maxLen, "topic", topic, "payload", payload)
+	return err
+}
+
+// connect returns the connection to Redis, connecting if necessary
+func (p *RedisPublisher) connect() (redis.Conn, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.conn != nil && p.conn.Err() == nil {
+		return p.conn, nil
+	}
+
+	conn, err := redis.Dial(p.url, 0)
+	if err != nil {
+		return nil, err
+	}
+	p.conn = conn
+
+	return conn, nil
+}
+
+// Close ...
+func (p *RedisPublisher) Close() error {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.conn != nil {
+		p.conn.Close()
+		p.conn = nil
+	}
+	return nil
+}
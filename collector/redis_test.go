@@ -0,0 +1,45 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/prologic/autodock/config"
+)
+
+func TestRedisPublisher(t *testing.T) {
+	m, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	p := NewRedisPublisher("redis://"+m.Addr(), config.RedisConfig{Stream: "events"})
+	defer p.Close()
+
+	if err := p.Publish("container.die.web_1", []byte(`{"n":1}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	// reconnects after the connection failed
+	m.Restart()
+	p.Publish("container.die.web_1", []byte(`{"n":2}`))
+	if err := p.Publish("container.die.web_1", []byte(`{"n":3}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := m.Stream("events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) < 2 {
+		t.Fatalf("expected at least 2 entries got %d", len(entries))
+	}
+	last := entries[len(entries)-1]
+	expected := []string{"topic", "container.die.web_1", "payload", `{"n":3}`}
+	if !reflect.DeepEqual(last.Values, expected) {
+		t.Errorf("expected entry %v got %v", expected, last.Values)
+	}
+}
@@ -0,0 +1,141 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	etypes "github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/prologic/autodock/events"
+)
+
+const (
+	// ActionExists is the action of events published for each object that
+	// exists when the collector (re)connects to Docker
+	ActionExists = "exists"
+
+	// ActionSnapshot is the action of the autodock event published once
+	// all exists events of a snapshot have been published
+	ActionSnapshot = "snapshot"
+)
+
+// snapshot publishes an exists event for each container, network, volume
+// and, on swarm managers, each service and node, followed by a snapshot
+// event so that plugins can reconcile their state with Docker's
+func (c *Collector) snapshot(ctx context.Context, info types.Info) error {
+	log.Debug("publishing snapshot")
+
+	c.Lock()
+	filter := c.filter
+	c.Unlock()
+
+	now := time.Now()
+	count := 0
+
+	exists := func(typ, scope, id string, attributes map[string]string, labels map[string]string) {
+		for k, v := range labels {
+			if _, ok := attributes[k]; !ok {
+				attributes[k] = v
+			}
+		}
+
+		msg := etypes.Message{
+			Type:     typ,
+			Action:   ActionExists,
+			Actor:    etypes.Actor{ID: id, Attributes: attributes},
+			Scope:    scope,
+			Time:     now.Unix(),
+			TimeNano: now.UnixNano(),
+		}
+		if !filter.Match(msg) {
+			return
+		}
+
+		c.send(ctx, events.NewMessage(msg))
+		count++
+	}
+
+	containers, err := c.client.ContainerList(ctx, types.ContainerListOptions{All: true})
+	if err != nil {
+		return fmt.Errorf("error listing containers: %s", err)
+	}
+	for _, container := range containers {
+		var name string
+		if len(container.Names) > 0 {
+			name = strings.TrimPrefix(container.Names[0], "/")
+		}
+		exists(etypes.ContainerEventType, "local", container.ID, map[string]string{
+			"name":   name,
+			"image":  container.Image,
+			"state":  container.State,
+			"status": container.Status,
+		}, container.Labels)
+	}
+
+	networks, err := c.client.NetworkList(ctx, types.NetworkListOptions{})
+	if err != nil {
+		return fmt.Errorf("error listing networks: %s", err)
+	}
+	for _, network := range networks {
+		exists(etypes.NetworkEventType, network.Scope, network.ID, map[string]string{
+			"name":   network.Name,
+			"driver": network.Driver,
+		}, network.Labels)
+	}
+
+	volumes, err := c.client.VolumeList(ctx, filters.NewArgs())
+	if err != nil {
+		return fmt.Errorf("error listing volumes: %s", err)
+	}
+	for _, volume := range volumes.Volumes {
+		exists(etypes.VolumeEventType, volume.Scope, volume.Name, map[string]string{
+			"driver": volume.Driver,
+		}, volume.Labels)
+	}
+
+	if info.Swarm.ControlAvailable {
+		services, err := c.client.ServiceList(ctx, types.ServiceListOptions{})
+		if err != nil {
+			return fmt.Errorf("error listing services: %s", err)
+		}
+		for _, service := range services {
+			attributes := map[string]string{"name": service.Spec.Name}
+			if spec := service.Spec.TaskTemplate.ContainerSpec; spec != nil {
+				attributes["image"] = spec.Image
+			}
+			exists(etypes.ServiceEventType, "swarm", service.ID, attributes, service.Spec.Labels)
+		}
+
+		nodes, err := c.client.NodeList(ctx, types.NodeListOptions{})
+		if err != nil {
+			return fmt.Errorf("error listing nodes: %s", err)
+		}
+		for _, node := range nodes {
+			exists(etypes.NodeEventType, "swarm", node.ID, map[string]string{
+				"name":         node.Description.Hostname,
+				"role":         string(node.Spec.Role),
+				"availability": string(node.Spec.Availability),
+				"state":        string(node.Status.State),
+			}, node.Spec.Labels)
+		}
+	}
+
+	c.send(ctx, events.NewMessage(etypes.Message{
+		Type:   events.AutodockEventType,
+		Action: ActionSnapshot,
+		Actor: etypes.Actor{
+			ID:         "collector",
+			Attributes: map[string]string{"count": strconv.Itoa(count)},
+		},
+		Time:     now.Unix(),
+		TimeNano: now.UnixNano(),
+	}))
+
+	return nil
+}
@@ -0,0 +1,292 @@
+package collector
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jpillora/backoff"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/prologic/autodock/config"
+	"github.com/prologic/autodock/events"
+)
+
+const (
+	defaultWebhookTimeout    = time.Second * 10
+	defaultWebhookMaxRetries = 10
+	defaultWebhookQueueSize  = 10000
+)
+
+// errRejected is returned by deliver if the endpoint rejected an event
+// and retrying is pointless
+type errRejected struct {
+	status string
+}
+
+func (e errRejected) Error() string {
+	return fmt.Sprintf("rejected by endpoint: %s", e.status)
+}
+
+// deadLetter is an event that could not be delivered
+type deadLetter struct {
+	Topic    string          `json:"topic"`
+	Payload  json.RawMessage `json:"payload"`
+	Attempts int             `json:"attempts"`
+	Error    string          `json:"error"`
+	Created  time.Time       `json:"created"`
+	Failed   time.Time       `json:"failed"`
+}
+
+// WebhookPublisher POSTs events to a URL. Events are queued on disk and
+// delivered in order by a background worker, retrying failed deliveries
+// with exponential backoff. Events that cannot be delivered are appended
+// to a dead letter log.
+type WebhookPublisher struct {
+	name       string
+	url        string
+	secret     []byte
+	client     *http.Client
+	maxRetries int
+	backoff    config.BackoffConfig
+	deadLetter string
+	queuePath  string
+	queueSize  int
+
+	queue *diskQueue
+	err   error
+
+	start   sync.Once
+	close   sync.Once
+	wake    chan struct{}
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// NewWebhookPublisher creates a webhook publisher named name. Its queue is
+// opened and delivery started with the first event published, so that a
+// publisher replaced on reload has stopped using the queue by then.
+func NewWebhookPublisher(name, url string, cfg config.WebhookConfig) (*WebhookPublisher, error) {
+	if cfg.Timeout.Duration == 0 {
+		cfg.Timeout.Duration = defaultWebhookTimeout
+	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = defaultWebhookMaxRetries
+	}
+	if cfg.QueueSize == 0 {
+		cfg.QueueSize = defaultWebhookQueueSize
+	}
+	if cfg.Backoff.Min.Duration == 0 {
+		cfg.Backoff.Min.Duration = time.Second
+	}
+	if cfg.Backoff.Max.Duration == 0 {
+		cfg.Backoff.Max.Duration = time.Minute * 5
+	}
+	if cfg.Backoff.Factor < 1 {
+		cfg.Backoff.Factor = 2
+	}
+
+	if err := os.MkdirAll(cfg.QueuePath, 0755); err != nil {
+		return nil, fmt.Errorf("error creating queue: %s", err)
+	}
+
+	return &WebhookPublisher{
+		name:       name,
+		url:        url,
+		secret:     []byte(cfg.Secret),
+		client:     &http.Client{Timeout: cfg.Timeout.Duration},
+		maxRetries: cfg.MaxRetries,
+		backoff:    cfg.Backoff,
+		deadLetter: cfg.DeadLetter,
+		queuePath:  cfg.QueuePath,
+		queueSize:  cfg.QueueSize,
+
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}, nil
+}
+
+// Publish queues an event for delivery. If the queue is full the event is
+// written to the dead letter log.
+func (p *WebhookPublisher) Publish(topic string, payload []byte) error {
+	p.start.Do(func() {
+		p.queue, p.err = openDiskQueue(p.queuePath, p.queueSize)
+		if p.err != nil {
+			close(p.stopped)
+			return
+		}
+		go p.run()
+	})
+	if p.err != nil {
+		return fmt.Errorf("error queueing event for webhook %s: %s", p.name, p.err)
+	}
+
+	if err := p.queue.Push(topic, payload); err != nil {
+		p.bury(&queueEntry{Topic: topic, Payload: payload, Created: time.Now()}, err)
+		return fmt.Errorf("error queueing event for webhook %s: %s", p.name, err)
+	}
+
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Close stops delivering events; queued events are delivered once a
+// publisher with the same queue is created again
+func (p *WebhookPublisher) Close() error {
+	started := true
+	p.start.Do(func() { started = false })
+
+	p.close.Do(func() { close(p.stop) })
+
+	if started {
+		<-p.stopped
+		if p.queue != nil {
+			p.queue.Close()
+		}
+	}
+	return nil
+}
+
+// run delivers queued events in order until the publisher is closed
+func (p *WebhookPublisher) run() {
+	defer close(p.stopped)
+
+	b := &backoff.Backoff{
+		Min:    p.backoff.Min.Duration,
+		Max:    p.backoff.Max.Duration,
+		Factor: p.backoff.Factor,
+		Jitter: p.backoff.Jitter,
+	}
+
+	for {
+		e, err := p.queue.Peek()
+		if err != nil {
+			log.Errorf("webhook %s: %s", p.name, err)
+		}
+
+		var wait <-chan time.Time
+		if e != nil && err == nil {
+			if err := p.deliver(e); err != nil {
+				e.Attempts++
+				_, rejected := err.(errRejected)
+
+				if rejected || e.Attempts > p.maxRetries {
+					log.Errorf("webhook %s: giving up delivering event %s after %d attempts: %s",
+						p.name, e.Topic, e.Attempts, err)
+					p.bury(e, err)
+					p.queue.Remove(e.Seq)
+					b.Reset()
+					continue
+				}
+
+				log.Warnf("webhook %s: error delivering event %s (attempt %d): %s",
+					p.name, e.Topic, e.Attempts, err)
+				if err := p.queue.Update(e); err != nil {
+					log.Errorf("webhook %s: %s", p.name, err)
+				}
+				wait = time.After(b.ForAttempt(float64(e.Attempts - 1)))
+			} else {
+				p.queue.Remove(e.Seq)
+				b.Reset()
+				continue
+			}
+		}
+
+		select {
+		case <-wait:
+		case <-p.wake:
+			if wait != nil {
+				// keep backing off; new events queue behind the failing one
+				select {
+				case <-wait:
+				case <-p.stop:
+					return
+				}
+			}
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// deliver POSTs an event to the endpoint
+func (p *WebhookPublisher) deliver(e *queueEntry) error {
+	req, err := http.NewRequest(http.MethodPost, p.url, bytes.NewReader(e.Payload))
+	if err != nil {
+		return errRejected{err.Error()}
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Autodock-Topic", e.Topic)
+	req.Header.Set("X-Autodock-Delivery", events.EventID(e.Topic, e.Payload))
+	req.Header.Set("X-Autodock-Attempt", strconv.Itoa(e.Attempts+1))
+	if len(p.secret) > 0 {
+		mac := hmac.New(sha256.New, p.secret)
+		mac.Write(e.Payload)
+		req.Header.Set("X-Autodock-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return nil
+	case res.StatusCode == http.StatusRequestTimeout, res.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("unexpected response: %s", res.Status)
+	case res.StatusCode >= 400 && res.StatusCode < 500:
+		return errRejected{res.Status}
+	default:
+		return fmt.Errorf("unexpected response: %s", res.Status)
+	}
+}
+
+// bury appends an undeliverable event to the dead letter log
+func (p *WebhookPublisher) bury(e *queueEntry, reason error) {
+	if p.deadLetter == "" {
+		return
+	}
+
+	data, err := json.Marshal(&deadLetter{
+		Topic:    e.Topic,
+		Payload:  e.Payload,
+		Attempts: e.Attempts,
+		Error:    reason.Error(),
+		Created:  e.Created,
+		Failed:   time.Now(),
+	})
+	if err != nil {
+		log.Errorf("webhook %s: error encoding dead letter: %s", p.name, err)
+		return
+	}
+
+	f, err := os.OpenFile(p.deadLetter, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		log.Errorf("webhook %s: error opening dead letter log: %s", p.name, err)
+		return
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		log.Errorf("webhook %s: error writing dead letter log: %s", p.name, err)
+	}
+}
@@ -0,0 +1,224 @@
+package collector
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prologic/autodock/config"
+	"github.com/prologic/autodock/events"
+)
+
+type webhookRequest struct {
+	topic     string
+	delivery  string
+	attempt   string
+	signature string
+	body      string
+}
+
+// webhookEndpoint records requests and responds with the next of statuses,
+// then 200 OK
+type webhookEndpoint struct {
+	*httptest.Server
+	sync.Mutex
+
+	statuses []int
+	requests []webhookRequest
+}
+
+func newWebhookEndpoint(statuses ...int) *webhookEndpoint {
+	e := &webhookEndpoint{statuses: statuses}
+	e.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		e.Lock()
+		e.requests = append(e.requests, webhookRequest{
+			topic:     r.Header.Get("X-Autodock-Topic"),
+			delivery:  r.Header.Get("X-Autodock-Delivery"),
+			attempt:   r.Header.Get("X-Autodock-Attempt"),
+			signature: r.Header.Get("X-Autodock-Signature"),
+			body:      string(body),
+		})
+		status := http.StatusOK
+		if len(e.statuses) > 0 {
+			status, e.statuses = e.statuses[0], e.statuses[1:]
+		}
+		e.Unlock()
+
+		w.WriteHeader(status)
+	}))
+	return e
+}
+
+func (e *webhookEndpoint) Requests() []webhookRequest {
+	e.Lock()
+	defer e.Unlock()
+
+	return append([]webhookRequest(nil), e.requests...)
+}
+
+func newTestWebhook(t *testing.T, url string) (*WebhookPublisher, string) {
+	dir, err := ioutil.TempDir("", "autodock-webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewWebhookPublisher("test", url, config.WebhookConfig{
+		Secret:     "s3cret",
+		MaxRetries: 2,
+		Backoff: config.BackoffConfig{
+			Min:    config.Duration{Duration: time.Millisecond * 10},
+			Max:    config.Duration{Duration: time.Millisecond * 10},
+			Factor: 2,
+		},
+		QueuePath:  dir,
+		DeadLetter: filepath.Join(dir, "dead-letter.jsonl"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, dir
+}
+
+func TestWebhookPublisher(t *testing.T) {
+	endpoint := newWebhookEndpoint(http.StatusInternalServerError)
+	defer endpoint.Close()
+
+	p, dir := newTestWebhook(t, endpoint.URL)
+	defer os.RemoveAll(dir)
+	defer p.Close()
+
+	payload := `{"Type":"container","Action":"die"}`
+	if err := p.Publish("container.die.web_1", []byte(payload)); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, func() bool { return len(endpoint.Requests()) == 2 })
+	waitFor(t, func() bool { return p.queue.Len() == 0 })
+
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(payload))
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	// the delivery id is the same for each attempt and after restarting
+	delivery := events.EventID("container.die.web_1", []byte(payload))
+
+	for i, r := range endpoint.Requests() {
+		if r.topic != "container.die.web_1" || r.body != payload {
+			t.Errorf("request %d: got %s %s", i, r.topic, r.body)
+		}
+		if r.delivery != delivery {
+			t.Errorf("request %d: expected delivery %s got %s", i, delivery, r.delivery)
+		}
+		if r.signature != signature {
+			t.Errorf("request %d: bad signature %s", i, r.signature)
+		}
+	}
+	if attempt := endpoint.Requests()[1].attempt; attempt != "2" {
+		t.Errorf("expected attempt 2 got %s", attempt)
+	}
+}
+
+func TestWebhookPublisherDeadLetter(t *testing.T) {
+	endpoint := newWebhookEndpoint(http.StatusBadRequest, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+	defer endpoint.Close()
+
+	p, dir := newTestWebhook(t, endpoint.URL)
+	defer os.RemoveAll(dir)
+	defer p.Close()
+
+	// rejected by the endpoint, then failing more than MaxRetries times
+	p.Publish("container.start.web_1", []byte(`{"n":1}`))
+	p.Publish("container.stop.web_1", []byte(`{"n":2}`))
+
+	waitFor(t, func() bool { return len(endpoint.Requests()) == 4 })
+	waitFor(t, func() bool { return p.queue.Len() == 0 })
+
+	f, err := os.Open(filepath.Join(dir, "dead-letter.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var buried []deadLetter
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var d deadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &d); err != nil {
+			t.Fatal(err)
+		}
+		buried = append(buried, d)
+	}
+
+	if len(buried) != 2 {
+		t.Fatalf("expected 2 dead letters got %d", len(buried))
+	}
+	if buried[0].Topic != "container.start.web_1" || buried[0].Attempts != 1 {
+		t.Errorf("unexpected dead letter %+v", buried[0])
+	}
+	if buried[1].Topic != "container.stop.web_1" || buried[1].Attempts != 3 {
+		t.Errorf("unexpected dead letter %+v", buried[1])
+	}
+}
+
+func TestWebhookPublisherResumes(t *testing.T) {
+	endpoint := newWebhookEndpoint()
+	defer endpoint.Close()
+
+	dir, err := ioutil.TempDir("", "autodock-webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// events queued by a previous run
+	q, err := openDiskQueue(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Push("container.start.web_1", []byte(`{"n":1}`))
+	q.Close()
+
+	p, err := NewWebhookPublisher("test", endpoint.URL, config.WebhookConfig{QueuePath: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	p.Publish("container.stop.web_1", []byte(`{"n":2}`))
+
+	waitFor(t, func() bool { return len(endpoint.Requests()) == 2 })
+
+	requests := endpoint.Requests()
+	if requests[0].topic != "container.start.web_1" || requests[1].topic != "container.stop.web_1" {
+		t.Errorf("events delivered out of order: %+v", requests)
+	}
+	if requests[0].signature != "" {
+		t.Errorf("expected no signature got %s", requests[0].signature)
+	}
+}
+
+func TestTopicFilterPublisher(t *testing.T) {
+	recorder := &recordingPublisher{}
+	p := NewTopicFilterPublisher(recorder, []string{"container.die", "service.#"})
+
+	for _, topic := range []string{"container.die.web_1", "container.start.web_1", "service.update.web", "image.pull.nginx"} {
+		p.Publish(topic, nil)
+	}
+
+	topics := recorder.topics
+	if len(topics) != 2 || topics[0] != "container.die.web_1" || topics[1] != "service.update.web" {
+		t.Errorf("unexpected topics %v", topics)
+	}
+}
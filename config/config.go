@@ -1,13 +1,622 @@
+// Package config defines autodock's configuration and how it is loaded.
+//
+// Configuration is assembled from several sources. In increasing order of
+// precedence these are:
+//
+//  1. Built-in defaults (see Default)
+//  2. A configuration file (YAML, TOML or JSON) given by --config
+//  3. Environment variables prefixed with AUTODOCK_
+//  4. Command-line flags that were explicitly set
+//
+// Each source only overrides the settings it actually specifies.
 package config
 
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/docker/docker/client"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// PublisherMessageBus publishes events to a local or remote msgbus
+	PublisherMessageBus = "msgbus"
+
+	// PublisherWebhook POSTs events to a URL
+	PublisherWebhook = "webhook"
+
+	// PublisherFile writes events as JSON lines to a file or stdout
+	PublisherFile = "file"
+
+	// PublisherMQTT publishes events to an MQTT broker
+	PublisherMQTT = "mqtt"
+
+	// PublisherRedis adds events to a Redis stream
+	PublisherRedis = "redis"
+
+	// FormatDocker publishes events as received from Docker
+	FormatDocker = "docker"
+
+	// FormatCloudEvents publishes events as CloudEvents 1.0 in structured
+	// JSON mode
+	FormatCloudEvents = "cloudevents"
+
+	// HookAuthToken authenticates webhooks with a shared secret
+	HookAuthToken = "token"
+
+	// HookAuthHMAC authenticates webhooks with a HMAC-SHA256 signature
+	HookAuthHMAC = "hmac"
+)
+
 // Config ...
 type Config struct {
-	Debug         bool
-	Bind          string
-	MsgBusURL     string
-	DockerURL     string
-	TLSCACert     string
-	TLSCert       string
-	TLSKey        string
-	AllowInsecure bool
+	Debug         bool   `json:"debug"`
+	LogLevel      string `json:"log_level"`
+	Bind          string `json:"bind"`
+	MsgBusURL     string `json:"msgbus_url"`
+	DockerURL     string `json:"docker_url"`
+	TLSCACert     string `json:"tls_ca_cert"`
+	TLSCert       string `json:"tls_cert"`
+	TLSKey        string `json:"tls_key"`
+	AllowInsecure bool   `json:"allow_insecure"`
+
+	// WatchConfig reloads the configuration file whenever it changes
+	WatchConfig bool `json:"watch_config"`
+
+	// ShutdownTimeout bounds how long in-flight requests and events are
+	// drained for on shutdown
+	ShutdownTimeout Duration `json:"shutdown_timeout"`
+
+	Proxy      ProxyConfig       `json:"proxy"`
+	Collector  CollectorConfig   `json:"collector"`
+	Publishers []PublisherConfig `json:"publishers"`
+	Journal    JournalConfig     `json:"journal"`
+	Hooks      HooksConfig       `json:"hooks"`
+}
+
+// ProxyConfig configures the Docker API proxy exposed to plugins
+type ProxyConfig struct {
+	Enabled bool `json:"enabled"`
+
+	// Allow and Deny are access rules of the form "[METHOD] /path/glob"
+	// matched against the Docker API path without its version prefix.
+	// Deny rules take precedence; an empty Allow list allows everything.
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// CollectorConfig configures the Docker event collector
+type CollectorConfig struct {
+	Enabled bool          `json:"enabled"`
+	Backoff BackoffConfig `json:"backoff"`
+	Filters FilterConfig  `json:"filters"`
+
+	// Snapshot publishes an exists event for each container, service,
+	// network, volume and node on start and after reconnecting
+	Snapshot bool `json:"snapshot"`
+
+	Enrich EnrichConfig `json:"enrich"`
+
+	Queue QueueConfig `json:"queue"`
+}
+
+// QueueConfig configures the queue of events received from Docker waiting
+// to be published, which decouples reading the event stream from slow
+// publishers
+type QueueConfig struct {
+	Size int `json:"size"`
+
+	// Overflow is what happens to events received while the queue is
+	// full: OverflowBlock (the default) stops reading events from Docker
+	// until there is room, OverflowDropOldest and OverflowDropNewest drop
+	// the oldest queued or the received event
+	Overflow string `json:"overflow"`
+}
+
+// Overflow policies of the collector's queue
+const (
+	OverflowBlock      = "block"
+	OverflowDropOldest = "drop_oldest"
+	OverflowDropNewest = "drop_newest"
+)
+
+// EnrichConfig controls which events have metadata about the object they
+// concern attached. Each enriched event may cost an inspect call to
+// Docker; results are cached for TTL.
+type EnrichConfig struct {
+	Types []string `json:"types"`
+	TTL   Duration `json:"ttl"`
+}
+
+// EnrichTypes are the event types that can be enriched
+var EnrichTypes = []string{"container", "service"}
+
+// hookName matches valid names of generic webhooks
+var hookName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// FilterConfig selects which Docker events are published. An event is
+// published if it matches any Include rule (or there are none) and does
+// not match any Exclude rule.
+type FilterConfig struct {
+	Include []FilterRule `json:"include"`
+	Exclude []FilterRule `json:"exclude"`
+}
+
+// FilterRule matches events on all of its non-empty fields. Type, Action,
+// Image and Name are globs where * matches any sequence of characters.
+// Label is either "key" or "key=value".
+type FilterRule struct {
+	Type   string `json:"type"`
+	Action string `json:"action"`
+	Label  string `json:"label"`
+	Image  string `json:"image"`
+	Name   string `json:"name"`
+	Scope  string `json:"scope"`
+}
+
+// BackoffConfig controls how the collector reconnects to Docker
+type BackoffConfig struct {
+	Min    Duration `json:"min"`
+	Max    Duration `json:"max"`
+	Factor float64  `json:"factor"`
+	Jitter bool     `json:"jitter"`
+
+	// MaxRetries is the number of consecutive failed attempts after which
+	// the collector is considered degraded (or fails if Fatal is set).
+	// Zero retries forever.
+	MaxRetries int  `json:"max_retries"`
+	Fatal      bool `json:"fatal"`
+}
+
+// JournalConfig configures the on-disk journal of published events
+type JournalConfig struct {
+	Enabled bool   `json:"enabled"`
+	Path    string `json:"path"`
+
+	// SegmentSize is the size in bytes of each journal file
+	SegmentSize int64 `json:"segment_size"`
+
+	// MaxAge and MaxSize (in bytes) limit how much of the journal is kept
+	MaxAge  Duration `json:"max_age"`
+	MaxSize int64    `json:"max_size"`
+}
+
+// HooksConfig configures the endpoints under /hooks/ receiving webhooks
+// from external services
+type HooksConfig struct {
+	DockerHub DockerHubHookConfig `json:"dockerhub"`
+	GitHub    GitHubHookConfig    `json:"github"`
+	Registry  RegistryHookConfig  `json:"registry"`
+
+	// Sources are generic webhooks received on /hooks/<name>
+	Sources []HookSourceConfig `json:"sources"`
+}
+
+// Enabled returns true if any webhook endpoint is enabled
+func (c HooksConfig) Enabled() bool {
+	return c.DockerHub.Enabled || c.GitHub.Enabled || c.Registry.Enabled || len(c.Sources) > 0
+}
+
+// DockerHubHookConfig configures /hooks/dockerhub. Docker Hub does not
+// sign webhooks so the webhook URL must include ?token=<Token>.
+type DockerHubHookConfig struct {
+	Enabled bool   `json:"enabled"`
+	Token   string `json:"token"`
+
+	// Callback confirms receipt of each webhook to Docker Hub's callback
+	// URL, e.g. to report success of an automated build's webhook chain
+	Callback bool `json:"callback"`
+}
+
+// GitHubHookConfig configures /hooks/github. Webhooks must be signed with
+// Secret.
+type GitHubHookConfig struct {
+	Enabled bool   `json:"enabled"`
+	Secret  string `json:"secret"`
+}
+
+// RegistryHookConfig configures /hooks/registry receiving notifications
+// from a Docker Registry v2. The registry's endpoint must be configured
+// with the header "Authorization: Bearer <Token>".
+type RegistryHookConfig struct {
+	Enabled bool   `json:"enabled"`
+	Token   string `json:"token"`
+
+	// Actions are the registry actions published, by default push and
+	// delete
+	Actions []string `json:"actions"`
+}
+
+// RegistryActions are the actions of registry notifications
+var RegistryActions = []string{"push", "pull", "delete", "mount"}
+
+// HookSourceConfig configures a generic webhook received on /hooks/<name>
+// whose JSON payload is published as is
+type HookSourceConfig struct {
+	Name string `json:"name"`
+
+	// Auth is either HookAuthToken, requiring Secret in Header (by default
+	// "Authorization: Bearer <secret>") or ?token=, or HookAuthHMAC,
+	// requiring the hex HMAC-SHA256 of the body with Secret in Header (by
+	// default X-Signature, optionally prefixed with sha256=)
+	Auth   string `json:"auth"`
+	Secret string `json:"secret"`
+	Header string `json:"header"`
+
+	// Topic is the topic payloads are published on, by default
+	// hook.<name>. {path} is replaced by the value at the dotted JSON path
+	// in the payload, e.g. alertmanager.{status}.{commonLabels.alertname}
+	Topic string `json:"topic"`
+
+	// Require lists JSON paths that must be present in payloads
+	Require []string `json:"require"`
+}
+
+// PublisherConfig configures a single sink events are published to
+type PublisherConfig struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	URL  string `json:"url"`
+
+	// Format is the format events are published in, either FormatDocker
+	// (the default) or FormatCloudEvents
+	Format string `json:"format"`
+
+	// Source is the source of CloudEvents, by default autodock://<hostname>
+	Source string `json:"source"`
+
+	// Topics are topic patterns, e.g. container.die or service.#,
+	// selecting the events published; all events if empty
+	Topics []string `json:"topics"`
+
+	// Buffer is the number of events buffered for the publisher so that
+	// it never blocks the collector; further events are dropped while
+	// the buffer is full. 1000 by default.
+	Buffer int `json:"buffer"`
+
+	// Webhook configures webhook publishers
+	Webhook WebhookConfig `json:"webhook"`
+
+	// File configures file publishers
+	File FileConfig `json:"file"`
+
+	// MQTT configures MQTT publishers
+	MQTT MQTTConfig `json:"mqtt"`
+
+	// Redis configures Redis publishers
+	Redis RedisConfig `json:"redis"`
+}
+
+// RedisConfig configures a publisher adding events to a stream of the
+// Redis server at the publisher's URL, e.g. redis://:password@redis:6379/0
+type RedisConfig struct {
+	// Stream is the key of the stream, by default autodock
+	Stream string `json:"stream"`
+
+	// MaxLen trims the stream to approximately MaxLen entries, 100000 by
+	// default; -1 never trims it
+	MaxLen int64 `json:"max_len"`
+}
+
+// MQTTConfig configures a publisher publishing events to the MQTT broker
+// at the publisher's URL, e.g. tcp://broker:1883 or tls://broker:8883
+type MQTTConfig struct {
+	// Prefix is the MQTT topic events are published under, by default
+	// autodock; e.g. container.die.web_1 is published on
+	// autodock/container/die/web_1
+	Prefix string `json:"prefix"`
+
+	// QoS is the quality of service events are published with, 0 (the
+	// default) or 1
+	QoS int `json:"qos"`
+
+	// Retain asks the broker to retain the last event on each topic
+	Retain bool `json:"retain"`
+
+	// ClientID is by default autodock-<hostname>
+	ClientID  string   `json:"client_id"`
+	Username  string   `json:"username"`
+	Password  string   `json:"password"`
+	KeepAlive Duration `json:"keep_alive"`
+}
+
+// MQTTSchemes are the supported schemes of MQTT broker URLs
+var MQTTSchemes = []string{"tcp", "mqtt", "tls", "ssl", "mqtts"}
+
+// FileConfig configures a publisher writing events as JSON lines to a
+// file, or stdout if Path is empty or "-"
+type FileConfig struct {
+	Path string `json:"path"`
+
+	// MaxSize (in bytes) and MaxAge rotate the file once exceeded if set
+	MaxSize int64    `json:"max_size"`
+	MaxAge  Duration `json:"max_age"`
+
+	// MaxBackups is the number of rotated files kept; all if zero
+	MaxBackups int `json:"max_backups"`
+
+	// Compress compresses rotated files with gzip
+	Compress bool `json:"compress"`
+}
+
+// WebhookConfig configures a publisher POSTing events to a URL. Events
+// are queued on disk until delivered; events that cannot be delivered
+// after MaxRetries or are rejected by the endpoint are appended to the
+// DeadLetter log.
+type WebhookConfig struct {
+	// Secret signs requests with a HMAC-SHA256 of the body in the
+	// X-Autodock-Signature header if not empty
+	Secret string `json:"secret"`
+
+	Timeout    Duration      `json:"timeout"`
+	MaxRetries int           `json:"max_retries"`
+	Backoff    BackoffConfig `json:"backoff"`
+
+	// QueuePath is the directory events are queued in, by default
+	// /var/lib/autodock/webhooks/<name>
+	QueuePath string `json:"queue_path"`
+	QueueSize int    `json:"queue_size"`
+
+	// DeadLetter is the file undeliverable events are logged to, by
+	// default dead-letter.jsonl in QueuePath
+	DeadLetter string `json:"dead_letter"`
+}
+
+// Default returns a Config populated with the built-in defaults
+func Default() *Config {
+	return &Config{
+		LogLevel: "info",
+		Bind:     "0.0.0.0:8000",
+
+		ShutdownTimeout: Duration{time.Second * 30},
+
+		Proxy: ProxyConfig{
+			Enabled: true,
+		},
+		Collector: CollectorConfig{
+			Enabled:  true,
+			Snapshot: true,
+			Backoff: BackoffConfig{
+				Min:    Duration{time.Second},
+				Max:    Duration{time.Minute},
+				Factor: 2,
+				Jitter: true,
+			},
+			Enrich: EnrichConfig{
+				Types: []string{"container", "service"},
+				TTL:   Duration{time.Second * 10},
+			},
+			Queue: QueueConfig{
+				Size:     1000,
+				Overflow: OverflowBlock,
+			},
+		},
+		Hooks: HooksConfig{
+			Registry: RegistryHookConfig{
+				Actions: []string{"push", "delete"},
+			},
+		},
+		Journal: JournalConfig{
+			Path:        "/var/lib/autodock/journal",
+			SegmentSize: 16 << 20,
+			MaxAge:      Duration{time.Hour * 24 * 7},
+			MaxSize:     1 << 30,
+		},
+	}
+}
+
+// LocalMessageBus reports whether events are published to the embedded
+// message bus, in which case it must be exposed to plugins over HTTP.
+func (c *Config) LocalMessageBus() bool {
+	if len(c.Publishers) == 0 {
+		return c.MsgBusURL == ""
+	}
+
+	for _, p := range c.Publishers {
+		if p.Type == PublisherMessageBus && p.URL == "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Level returns the logging level to use
+func (c *Config) Level() log.Level {
+	if c.Debug {
+		return log.DebugLevel
+	}
+
+	level, err := log.ParseLevel(c.LogLevel)
+	if err != nil {
+		return log.InfoLevel
+	}
+
+	return level
+}
+
+// Validate checks the configuration for errors
+func (c *Config) Validate() error {
+	if _, err := log.ParseLevel(c.LogLevel); err != nil {
+		return fmt.Errorf("invalid log_level %q", c.LogLevel)
+	}
+
+	if _, _, err := net.SplitHostPort(c.Bind); err != nil {
+		return fmt.Errorf("invalid bind %q: %s", c.Bind, err)
+	}
+
+	if c.DockerURL != "" {
+		// as the Docker client parses it, e.g. unix://, tcp://, npipe://
+		if _, err := client.ParseHostURL(c.DockerURL); err != nil {
+			return fmt.Errorf("invalid docker_url %q: %s", c.DockerURL, err)
+		}
+	}
+
+	if c.ShutdownTimeout.Duration < 0 {
+		return fmt.Errorf("invalid shutdown_timeout %s", c.ShutdownTimeout)
+	}
+
+	if b := c.Collector.Backoff; b.Min.Duration <= 0 || b.Max.Duration < b.Min.Duration {
+		return fmt.Errorf("invalid collector.backoff: need 0 < min <= max")
+	} else if b.Factor < 1 {
+		return fmt.Errorf("invalid collector.backoff.factor %v: must be >= 1", b.Factor)
+	} else if b.MaxRetries < 0 {
+		return fmt.Errorf("invalid collector.backoff.max_retries %d", b.MaxRetries)
+	}
+
+	for _, rule := range append(c.Collector.Filters.Include, c.Collector.Filters.Exclude...) {
+		if rule == (FilterRule{}) {
+			return fmt.Errorf("invalid collector filter: rule matches nothing")
+		}
+		if rule.Scope != "" && rule.Scope != "local" && rule.Scope != "swarm" {
+			return fmt.Errorf("invalid collector filter: unknown scope %q", rule.Scope)
+		}
+	}
+
+	for _, typ := range c.Collector.Enrich.Types {
+		if !contains(EnrichTypes, typ) {
+			return fmt.Errorf("invalid collector.enrich.types: cannot enrich %q events", typ)
+		}
+	}
+	if c.Collector.Enrich.TTL.Duration < 0 {
+		return fmt.Errorf("invalid collector.enrich.ttl %s", c.Collector.Enrich.TTL)
+	}
+
+	if c.Collector.Queue.Size < 0 {
+		return fmt.Errorf("invalid collector.queue.size %d", c.Collector.Queue.Size)
+	}
+	switch c.Collector.Queue.Overflow {
+	case "", OverflowBlock, OverflowDropOldest, OverflowDropNewest:
+	default:
+		return fmt.Errorf("invalid collector.queue.overflow %q", c.Collector.Queue.Overflow)
+	}
+
+	if c.Journal.Enabled {
+		if c.Journal.Path == "" {
+			return fmt.Errorf("journal.path must be specified")
+		}
+		if c.Journal.SegmentSize <= 0 || c.Journal.MaxSize < 0 || c.Journal.MaxAge.Duration < 0 {
+			return fmt.Errorf("invalid journal: segment_size must be positive and max_size and max_age not negative")
+		}
+	}
+
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return fmt.Errorf("tls_cert and tls_key must be specified together")
+	}
+
+	for _, rule := range append(c.Proxy.Allow, c.Proxy.Deny...) {
+		if _, _, err := ParseAccessRule(rule); err != nil {
+			return fmt.Errorf("invalid proxy rule %q: %s", rule, err)
+		}
+	}
+
+	if c.Hooks.DockerHub.Enabled && c.Hooks.DockerHub.Token == "" {
+		return fmt.Errorf("hooks.dockerhub.token must be specified")
+	}
+	if c.Hooks.GitHub.Enabled && c.Hooks.GitHub.Secret == "" {
+		return fmt.Errorf("hooks.github.secret must be specified")
+	}
+	if c.Hooks.Registry.Enabled && c.Hooks.Registry.Token == "" {
+		return fmt.Errorf("hooks.registry.token must be specified")
+	}
+	for _, action := range c.Hooks.Registry.Actions {
+		if !contains(RegistryActions, action) {
+			return fmt.Errorf("invalid hooks.registry.actions: unknown action %q", action)
+		}
+	}
+
+	hooks := map[string]bool{"dockerhub": true, "github": true, "registry": true}
+	for i, h := range c.Hooks.Sources {
+		if !hookName.MatchString(h.Name) {
+			return fmt.Errorf("hooks.sources #%d has invalid name %q", i+1, h.Name)
+		}
+		if hooks[h.Name] {
+			return fmt.Errorf("duplicate or reserved hook name %q", h.Name)
+		}
+		hooks[h.Name] = true
+
+		switch h.Auth {
+		case HookAuthToken, HookAuthHMAC:
+		default:
+			return fmt.Errorf("hook %q has unsupported auth %q", h.Name, h.Auth)
+		}
+		if h.Secret == "" {
+			return fmt.Errorf("hook %q has no secret", h.Name)
+		}
+	}
+
+	names := make(map[string]bool)
+	for i, p := range c.Publishers {
+		if p.Name == "" {
+			return fmt.Errorf("publisher #%d has no name", i+1)
+		}
+		if names[p.Name] {
+			return fmt.Errorf("duplicate publisher %q", p.Name)
+		}
+		names[p.Name] = true
+
+		if p.Buffer < 0 {
+			return fmt.Errorf("publisher %q: buffer must not be negative", p.Name)
+		}
+
+		switch p.Type {
+		case PublisherMessageBus:
+		case PublisherWebhook:
+			if u, err := url.Parse(p.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return fmt.Errorf("publisher %q has invalid url %q", p.Name, p.URL)
+			}
+			w := p.Webhook
+			if w.MaxRetries < 0 || w.QueueSize < 0 || w.Timeout.Duration < 0 {
+				return fmt.Errorf("publisher %q: max_retries, queue_size and timeout must not be negative", p.Name)
+			}
+			if b := w.Backoff; b.Min.Duration < 0 || b.Max.Duration < b.Min.Duration {
+				return fmt.Errorf("publisher %q: invalid backoff: need 0 <= min <= max", p.Name)
+			}
+		case PublisherFile:
+			f := p.File
+			if f.MaxSize < 0 || f.MaxAge.Duration < 0 || f.MaxBackups < 0 {
+				return fmt.Errorf("publisher %q: max_size, max_age and max_backups must not be negative", p.Name)
+			}
+		case PublisherMQTT:
+			if u, err := url.Parse(p.URL); err != nil || !contains(MQTTSchemes, u.Scheme) {
+				return fmt.Errorf("publisher %q has invalid url %q", p.Name, p.URL)
+			}
+			if p.MQTT.QoS != 0 && p.MQTT.QoS != 1 {
+				return fmt.Errorf("publisher %q: qos must be 0 or 1", p.Name)
+			}
+			if p.MQTT.KeepAlive.Duration < 0 {
+				return fmt.Errorf("publisher %q: keep_alive must not be negative", p.Name)
+			}
+		case PublisherRedis:
+			if u, err := url.Parse(p.URL); err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") {
+				return fmt.Errorf("publisher %q has invalid url %q", p.Name, p.URL)
+			}
+			if p.Redis.MaxLen < -1 {
+				return fmt.Errorf("publisher %q: max_len must be -1 or more", p.Name)
+			}
+		default:
+			return fmt.Errorf("publisher %q has unsupported type %q", p.Name, p.Type)
+		}
+
+		switch p.Format {
+		case "", FormatDocker, FormatCloudEvents:
+		default:
+			return fmt.Errorf("publisher %q has unsupported format %q", p.Name, p.Format)
+		}
+	}
+
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,280 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testYAML = `
+# autodock configuration
+debug: false
+log_level: warn
+bind: "127.0.0.1:9000"
+docker_url: tcp://docker:2376 # remote daemon
+
+proxy:
+  allow:
+    - GET /containers/*
+    - "/info"
+  deny: [POST /containers/*/exec]
+
+publishers:
+  - name: local
+    type: msgbus
+  - name: remote
+    type: msgbus
+    url: http://msgbus:8000
+`
+
+const testTOML = `
+# autodock configuration
+debug = false
+log_level = "warn"
+bind = "127.0.0.1:9000"
+docker_url = 'tcp://docker:2376' # remote daemon
+
+[proxy]
+allow = [
+  "GET /containers/*",
+  "/info",
+]
+deny = ["POST /containers/*/exec"]
+
+[[publishers]]
+name = "local"
+type = "msgbus"
+
+[[publishers]]
+name = "remote"
+type = "msgbus"
+url = "http://msgbus:8000"
+`
+
+// writeConfig writes data to a temporary file name and returns its path
+// and a func removing it
+func writeConfig(t *testing.T, name, data string) (string, func()) {
+	dir, err := ioutil.TempDir("", "autodock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+
+	return path, cleanup
+}
+
+func TestLoad(t *testing.T) {
+	expected := Default()
+	expected.LogLevel = "warn"
+	expected.Bind = "127.0.0.1:9000"
+	expected.DockerURL = "tcp://docker:2376"
+	expected.Proxy.Allow = []string{"GET /containers/*", "/info"}
+	expected.Proxy.Deny = []string{"POST /containers/*/exec"}
+	expected.Publishers = []PublisherConfig{
+		{Name: "local", Type: "msgbus"},
+		{Name: "remote", Type: "msgbus", URL: "http://msgbus:8000"},
+	}
+
+	for name, data := range map[string]string{
+		"autodock.yml":  testYAML,
+		"autodock.toml": testTOML,
+	} {
+		path, cleanup := writeConfig(t, name, data)
+		defer cleanup()
+
+		cfg, err := Load(path)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		if !reflect.DeepEqual(cfg, expected) {
+			t.Errorf("%s: expected %+v; got %+v", name, expected, cfg)
+		}
+
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("%s: unexpected validation error: %s", name, err)
+		}
+	}
+}
+
+func TestLoadEnvOverridesFile(t *testing.T) {
+	os.Setenv("AUTODOCK_BIND", "0.0.0.0:1234")
+	os.Setenv("AUTODOCK_DEBUG", "true")
+	defer os.Unsetenv("AUTODOCK_BIND")
+	defer os.Unsetenv("AUTODOCK_DEBUG")
+
+	path, cleanup := writeConfig(t, "autodock.yaml", testYAML)
+	defer cleanup()
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Bind != "0.0.0.0:1234" {
+		t.Errorf("expected bind from environment; got %q", cfg.Bind)
+	}
+	if !cfg.Debug {
+		t.Error("expected debug from environment")
+	}
+	if cfg.LogLevel != "warn" {
+		t.Errorf("expected log_level from file; got %q", cfg.LogLevel)
+	}
+}
+
+func TestLoadYAML(t *testing.T) {
+	data := `
+x-defaults: &defaults
+  type: msgbus
+  format: cloudevents
+
+log_level: warn # it's a comment
+hooks:
+  github:
+    enabled: yes
+    secret: 123456
+  dockerhub:
+    token: 0123
+collector:
+  backoff:
+    min: 2   # seconds
+    max: 1m
+  filters:
+    include:
+      - {type: container, name: "web_#1"}
+publishers:
+  - <<: *defaults
+    name: it's
+  - <<: *defaults
+    name: remote
+    url: http://msgbus:8000
+`
+
+	path, cleanup := writeConfig(t, "autodock.yml", data)
+	defer cleanup()
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.LogLevel != "warn" {
+		t.Errorf("expected comment to be stripped; got %q", cfg.LogLevel)
+	}
+	if !cfg.Hooks.GitHub.Enabled || cfg.Hooks.GitHub.Secret != "123456" {
+		t.Errorf("unexpected github hook %+v", cfg.Hooks.GitHub)
+	}
+	if cfg.Hooks.DockerHub.Token != "0123" {
+		t.Errorf("expected token to be %q; got %q", "0123", cfg.Hooks.DockerHub.Token)
+	}
+	if cfg.Collector.Backoff.Min.Duration != time.Second*2 || cfg.Collector.Backoff.Max.Duration != time.Minute {
+		t.Errorf("unexpected backoff %+v", cfg.Collector.Backoff)
+	}
+
+	include := []FilterRule{{Type: "container", Name: "web_#1"}}
+	if !reflect.DeepEqual(cfg.Collector.Filters.Include, include) {
+		t.Errorf("expected filters %+v; got %+v", include, cfg.Collector.Filters.Include)
+	}
+
+	publishers := []PublisherConfig{
+		{Name: "it's", Type: "msgbus", Format: "cloudevents"},
+		{Name: "remote", Type: "msgbus", Format: "cloudevents", URL: "http://msgbus:8000"},
+	}
+	if !reflect.DeepEqual(cfg.Publishers, publishers) {
+		t.Errorf("expected publishers %+v; got %+v", publishers, cfg.Publishers)
+	}
+}
+
+func TestLoadUnknownKey(t *testing.T) {
+	path, cleanup := writeConfig(t, "autodock.yml", "bnid: :8000\n")
+	defer cleanup()
+
+	if _, err := Load(path); err == nil {
+		t.Fatal("expected error for unknown key")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		name   string
+		modify func(*Config)
+	}{
+		{"log level", func(c *Config) { c.LogLevel = "loud" }},
+		{"bind", func(c *Config) { c.Bind = "8000" }},
+		{"docker url", func(c *Config) { c.DockerURL = "localhost:2375" }},
+		{"tls", func(c *Config) { c.TLSCert = "cert.pem" }},
+		{"proxy rule", func(c *Config) { c.Proxy.Deny = []string{"GET containers"} }},
+		{"publisher type", func(c *Config) {
+			c.Publishers = []PublisherConfig{{Name: "foo", Type: "foo"}}
+		}},
+		{"publisher format", func(c *Config) {
+			c.Publishers = []PublisherConfig{{Name: "foo", Type: "msgbus", Format: "xml"}}
+		}},
+		{"hook name", func(c *Config) {
+			c.Hooks.Sources = []HookSourceConfig{{Name: "github", Auth: "token", Secret: "s3cret"}}
+		}},
+		{"hook auth", func(c *Config) {
+			c.Hooks.Sources = []HookSourceConfig{{Name: "ci", Auth: "none"}}
+		}},
+		{"publisher name", func(c *Config) {
+			c.Publishers = []PublisherConfig{
+				{Name: "foo", Type: "msgbus"},
+				{Name: "foo", Type: "msgbus"},
+			}
+		}},
+	}
+
+	if err := Default().Validate(); err != nil {
+		t.Fatalf("unexpected error validating defaults: %s", err)
+	}
+
+	// every scheme the Docker client supports
+	for _, dockerURL := range []string{
+		"unix:///var/run/docker.sock",
+		"tcp://docker:2376",
+		"npipe:////./pipe/docker_engine",
+		"https://docker:2376",
+	} {
+		cfg := Default()
+		cfg.DockerURL = dockerURL
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("unexpected error validating docker_url %q: %s", dockerURL, err)
+		}
+	}
+
+	for _, testCase := range testCases {
+		cfg := Default()
+		testCase.modify(cfg)
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: expected validation error", testCase.name)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a := Default()
+	b := Default()
+	b.LogLevel = "debug"
+	b.Proxy.Deny = []string{"/info"}
+	b.ShutdownTimeout.Duration = time.Minute
+	b.Collector.Backoff.Min.Duration = time.Second * 5
+
+	changes := Diff(a, b)
+	expected := []string{"log_level", "shutdown_timeout", "proxy.deny", "collector.backoff.min"}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Fatalf("expected %v; got %v", expected, changes)
+	}
+
+	if changes := Diff(a, Default()); len(changes) != 0 {
+		t.Fatalf("expected no changes; got %v", changes)
+	}
+}
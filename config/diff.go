@@ -0,0 +1,33 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Diff returns the names of the settings that differ between a and b as
+// they appear in a configuration file, e.g. "bind" or "proxy.allow".
+func Diff(a, b *Config) []string {
+	return diff("", reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem())
+}
+
+func diff(prefix string, a, b reflect.Value) []string {
+	var names []string
+
+	for i := 0; i < a.NumField(); i++ {
+		field := a.Type().Field(i)
+		name := prefix + strings.Split(field.Tag.Get("json"), ",")[0]
+
+		// structs decoding themselves, such as Duration, are single settings
+		if field.Type.Kind() == reflect.Struct && !reflect.PtrTo(field.Type).Implements(unmarshalerType) {
+			names = append(names, diff(name+".", a.Field(i), b.Field(i))...)
+			continue
+		}
+
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Duration is a time.Duration that is configured as a string such as
+// "30s" or "5m", or as a number of seconds
+type Duration struct {
+	time.Duration
+}
+
+// MarshalJSON ...
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON ...
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	switch value := v.(type) {
+	case float64:
+		d.Duration = time.Duration(value * float64(time.Second))
+	case string:
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		d.Duration = duration
+	default:
+		return fmt.Errorf("invalid duration %s", data)
+	}
+
+	return nil
+}
@@ -0,0 +1,223 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const envPrefix = "AUTODOCK_"
+
+// Load returns the configuration built from the defaults, the optional
+// configuration file at path and the environment. Command-line flags are
+// applied on top of this by the caller.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading config file: %s", err)
+	}
+
+	var doc interface{}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yml", ".yaml":
+		doc, err = parseYAML(data)
+	case ".toml":
+		doc, err = parseTOML(data)
+	case ".json":
+		err = json.Unmarshal(data, &doc)
+	default:
+		return fmt.Errorf("unsupported config file format %q", ext)
+	}
+	if err != nil {
+		return fmt.Errorf("error parsing config file %s: %s", path, err)
+	}
+
+	// The parsed document is re-encoded as JSON so that all formats share
+	// the same field names and decoding rules.
+	buf, err := json.Marshal(coerce(doc, reflect.TypeOf(c).Elem()))
+	if err != nil {
+		return fmt.Errorf("error parsing config file %s: %s", path, err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		return fmt.Errorf("error decoding config file %s: %s", path, err)
+	}
+
+	return nil
+}
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// coerce converts the scalars of a parsed document destined for string
+// fields of t to strings, e.g. so that secret: 123456 configures the secret
+// "123456". Scalars of YAML documents are converted to their text or value
+// and keys of the form x-* are dropped.
+func coerce(v interface{}, t reflect.Type) interface{} {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t != nil && reflect.PtrTo(t).Implements(unmarshalerType) {
+		// e.g. Duration, which decodes numbers and strings itself
+		t = nil
+	}
+
+	switch value := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(value))
+		for k, child := range value {
+			if t != nil && t.Kind() == reflect.Struct && strings.HasPrefix(k, "x-") {
+				// extension fields, e.g. holding YAML anchors as in
+				// docker-compose files, are ignored
+				continue
+			}
+			m[k] = coerce(child, fieldType(t, k))
+		}
+		return m
+	case []map[string]interface{}:
+		s := make([]interface{}, len(value))
+		for i, child := range value {
+			s[i] = coerce(child, elemType(t))
+		}
+		return s
+	case []interface{}:
+		s := make([]interface{}, len(value))
+		for i, child := range value {
+			s[i] = coerce(child, elemType(t))
+		}
+		return s
+	case yamlScalar:
+		if t != nil && t.Kind() == reflect.String {
+			return value.text
+		}
+		return coerce(value.value, t)
+	case nil, string:
+		return value
+	default:
+		if t != nil && t.Kind() == reflect.String {
+			return fmt.Sprint(value)
+		}
+		return value
+	}
+}
+
+// fieldType returns the type of the field of struct t or the values of map
+// t decoded from key, or nil if unknown
+func fieldType(t reflect.Type, key string) reflect.Type {
+	if t == nil {
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Map:
+		return t.Elem()
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			if name == "" {
+				name = f.Name
+			}
+			if strings.EqualFold(name, key) {
+				return f.Type
+			}
+		}
+	}
+
+	return nil
+}
+
+// elemType returns the type of the elements of slice t, or nil if unknown
+func elemType(t reflect.Type) reflect.Type {
+	if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+		return t.Elem()
+	}
+	return nil
+}
+
+func (c *Config) loadEnv() error {
+	strs := map[string]*string{
+		"LOG_LEVEL":    &c.LogLevel,
+		"BIND":         &c.Bind,
+		"MSGBUS_URL":   &c.MsgBusURL,
+		"DOCKER_URL":   &c.DockerURL,
+		"TLS_CA_CERT":  &c.TLSCACert,
+		"TLS_CERT":     &c.TLSCert,
+		"TLS_KEY":      &c.TLSKey,
+		"JOURNAL_PATH": &c.Journal.Path,
+
+		"COLLECTOR_QUEUE_OVERFLOW": &c.Collector.Queue.Overflow,
+
+		"HOOKS_DOCKERHUB_TOKEN": &c.Hooks.DockerHub.Token,
+		"HOOKS_GITHUB_SECRET":   &c.Hooks.GitHub.Secret,
+		"HOOKS_REGISTRY_TOKEN":  &c.Hooks.Registry.Token,
+	}
+
+	for name, ptr := range strs {
+		if value, ok := os.LookupEnv(envPrefix + name); ok {
+			*ptr = value
+		}
+	}
+
+	bools := map[string]*bool{
+		"DEBUG":              &c.Debug,
+		"ALLOW_INSECURE":     &c.AllowInsecure,
+		"WATCH_CONFIG":       &c.WatchConfig,
+		"PROXY_ENABLED":      &c.Proxy.Enabled,
+		"COLLECTOR_ENABLED":  &c.Collector.Enabled,
+		"COLLECTOR_SNAPSHOT": &c.Collector.Snapshot,
+		"JOURNAL_ENABLED":    &c.Journal.Enabled,
+
+		"HOOKS_DOCKERHUB_ENABLED": &c.Hooks.DockerHub.Enabled,
+		"HOOKS_GITHUB_ENABLED":    &c.Hooks.GitHub.Enabled,
+		"HOOKS_REGISTRY_ENABLED":  &c.Hooks.Registry.Enabled,
+	}
+
+	for name, ptr := range bools {
+		if value, ok := os.LookupEnv(envPrefix + name); ok {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid value for %s%s: %q", envPrefix, name, value)
+			}
+			*ptr = b
+		}
+	}
+
+	durations := map[string]*Duration{
+		"SHUTDOWN_TIMEOUT": &c.ShutdownTimeout,
+	}
+
+	for name, ptr := range durations {
+		if value, ok := os.LookupEnv(envPrefix + name); ok {
+			if err := ptr.UnmarshalJSON([]byte(strconv.Quote(value))); err != nil {
+				return fmt.Errorf("invalid value for %s%s: %q", envPrefix, name, value)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ParseAccessRule parses a proxy access rule of the form "[METHOD] /path"
+// where path is a glob as understood by path.Match. A rule without a method
+// matches all methods.
+func ParseAccessRule(rule string) (method, pattern string, err error) {
+	fields := strings.Fields(rule)
+
+	switch len(fields) {
+	case 1:
+		pattern = fields[0]
+	case 2:
+		method, pattern = strings.ToUpper(fields[0]), fields[1]
+	default:
+		return "", "", fmt.Errorf("expected \"[METHOD] /path\"")
+	}
+
+	if !strings.HasPrefix(pattern, "/") {
+		return "", "", fmt.Errorf("path must begin with /")
+	}
+
+	if _, err := path.Match(pattern, "/"); err != nil {
+		return "", "", err
+	}
+
+	return method, pattern, nil
+}
@@ -0,0 +1,14 @@
+package config
+
+import (
+	"github.com/BurntSushi/toml"
+)
+
+// parseTOML parses a TOML document into maps, slices and scalars
+func parseTOML(data []byte) (interface{}, error) {
+	var doc map[string]interface{}
+	if _, err := toml.Decode(string(data), &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultWatchInterval is how often a watched config file is checked
+const DefaultWatchInterval = time.Second * 5
+
+// Watch polls the file at path every interval and calls fn whenever its
+// modification time or size changes. Watching stops when done is closed.
+func Watch(path string, interval time.Duration, done <-chan struct{}, fn func()) {
+	stat := func() (time.Time, int64) {
+		fi, err := os.Stat(path)
+		if err != nil {
+			log.Warnf("error watching config file: %s", err)
+			return time.Time{}, -1
+		}
+		return fi.ModTime(), fi.Size()
+	}
+
+	modTime, size := stat()
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+			newModTime, newSize := stat()
+			if newSize == -1 || (newModTime.Equal(modTime) && newSize == size) {
+				continue
+			}
+			modTime, size = newModTime, newSize
+
+			log.Infof("config file %s changed", path)
+			fn()
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	yaml "gopkg.in/yaml.v2"
+)
+
+// yamlNode is a node of a YAML document that keeps the text of scalars, so
+// that e.g. a token written as 0123 configures the string "0123" rather
+// than the number 83
+type yamlNode struct {
+	// value is a map[string]*yamlNode, []*yamlNode or scalar
+	value interface{}
+	text  string
+}
+
+// UnmarshalYAML ...
+func (n *yamlNode) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v interface{}
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+
+	switch v.(type) {
+	case map[interface{}]interface{}:
+		var m map[string]*yamlNode
+		if err := unmarshal(&m); err != nil {
+			return err
+		}
+		n.value = m
+	case []interface{}:
+		var s []*yamlNode
+		if err := unmarshal(&s); err != nil {
+			return err
+		}
+		n.value = s
+	case nil:
+	default:
+		n.value = v
+		if err := unmarshal(&n.text); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseYAML parses a YAML document into maps, slices and scalars, the
+// scalars being yamlScalar so that their text is used for string fields
+func parseYAML(data []byte) (interface{}, error) {
+	var root *yamlNode
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	return root.document(), nil
+}
+
+// yamlScalar is a scalar of a YAML document: its text is used if decoded
+// into a string field and its value otherwise
+type yamlScalar struct {
+	value interface{}
+	text  string
+}
+
+func (n *yamlNode) document() interface{} {
+	if n == nil {
+		return nil
+	}
+
+	switch v := n.value.(type) {
+	case map[string]*yamlNode:
+		m := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			m[k] = child.document()
+		}
+		return m
+	case []*yamlNode:
+		s := make([]interface{}, len(v))
+		for i, child := range v {
+			s[i] = child.document()
+		}
+		return s
+	case nil:
+		return nil
+	default:
+		return yamlScalar{value: v, text: n.text}
+	}
+}
@@ -0,0 +1,104 @@
+package events
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// CloudEventsSpecVersion is the version of the CloudEvents
+	// specification events are encoded with
+	CloudEventsSpecVersion = "1.0"
+
+	// CloudEventTypePrefix prefixes the type of CloudEvents, which is
+	// otherwise the type and action of the event, e.g.
+	// io.autodock.container.die
+	CloudEventTypePrefix = "io.autodock."
+)
+
+// CloudEvent is an event encoded in the CloudEvents 1.0 structured JSON
+// format with the event as published by autodock as its data
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Time            time.Time       `json:"time"`
+	Subject         string          `json:"subject,omitempty"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data"`
+}
+
+// EventID returns an id for payload published on topic derived from both,
+// so that an event published more than once, e.g. when replayed, has the
+// same id
+func EventID(topic string, payload []byte) string {
+	sum := sha1.Sum(append([]byte(topic+"\n"), payload...))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewCloudEvent wraps payload published on topic as a CloudEvent from
+// source, with an id from EventID.
+func NewCloudEvent(source, topic string, payload []byte) (*CloudEvent, error) {
+	if !json.Valid(payload) {
+		return nil, fmt.Errorf("error encoding cloudevent: payload is not valid JSON")
+	}
+
+	// the type is the event type and action; the name is the subject
+	levels := SplitTopic(topic)
+	n := len(levels)
+	if n > 2 {
+		n = 2
+	}
+
+	e := &CloudEvent{
+		SpecVersion:     CloudEventsSpecVersion,
+		ID:              EventID(topic, payload),
+		Source:          source,
+		Type:            CloudEventTypePrefix + strings.Join(levels[:n], TopicSeparator),
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		Data:            payload,
+	}
+	if len(levels) > 2 {
+		e.Subject = levels[2]
+	}
+
+	var m Message
+	if err := json.Unmarshal(payload, &m); err == nil {
+		if m.TimeNano > 0 {
+			e.Time = time.Unix(0, m.TimeNano).UTC()
+		}
+		if m.Actor.ID != "" {
+			e.Subject = m.Actor.ID
+		}
+	}
+
+	return e, nil
+}
+
+// DecodeMessage decodes an event published by autodock in either its
+// native format or wrapped as a CloudEvent
+func DecodeMessage(payload []byte) (*Message, error) {
+	var envelope struct {
+		SpecVersion string          `json:"specversion"`
+		Data        json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		return nil, fmt.Errorf("error decoding event: %s", err)
+	}
+	if envelope.SpecVersion != "" {
+		payload = envelope.Data
+	}
+
+	var m Message
+	if err := json.Unmarshal(payload, &m); err != nil {
+		return nil, fmt.Errorf("error decoding event: %s", err)
+	}
+
+	return &m, nil
+}
@@ -0,0 +1,56 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	etypes "github.com/docker/docker/api/types/events"
+)
+
+func TestCloudEvent(t *testing.T) {
+	payload, _ := json.Marshal(&Message{
+		Message: etypes.Message{
+			Type:     "container",
+			Action:   "die",
+			Actor:    etypes.Actor{ID: "abc", Attributes: map[string]string{"name": "web_1"}},
+			TimeNano: 1546300800000000001,
+		},
+	})
+
+	e, err := NewCloudEvent("autodock://test", "container.die.web_1", payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.SpecVersion != "1.0" || e.Source != "autodock://test" || e.DataContentType != "application/json" {
+		t.Errorf("unexpected envelope: %+v", e)
+	}
+	if e.Type != "io.autodock.container.die" {
+		t.Errorf("expected type io.autodock.container.die; got %s", e.Type)
+	}
+	if e.Subject != "abc" {
+		t.Errorf("expected subject abc; got %s", e.Subject)
+	}
+	if !e.Time.Equal(time.Unix(0, 1546300800000000001)) {
+		t.Errorf("expected time of event; got %s", e.Time)
+	}
+
+	again, _ := NewCloudEvent("autodock://test", "container.die.web_1", payload)
+	if e.ID == "" || e.ID != again.ID {
+		t.Errorf("expected stable id; got %q and %q", e.ID, again.ID)
+	}
+
+	data, _ := json.Marshal(e)
+	m, err := DecodeMessage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Topic(m) != "container.die.web_1" {
+		t.Errorf("expected decoded event on container.die.web_1; got %s", Topic(m))
+	}
+
+	if _, err := NewCloudEvent("autodock://test", "container", []byte("nope")); err == nil {
+		t.Error("expected error wrapping invalid JSON")
+	}
+}
@@ -1,15 +1,87 @@
 package events
 
 import (
+	"errors"
+
 	etypes "github.com/docker/docker/api/types/events"
 )
 
-// Handler ...
+const (
+	// AutodockEventType is the type of events generated by autodock itself,
+	// such as changes in the state of the collector
+	AutodockEventType = "autodock"
+
+	// SchemaVersion is the version of the schema of events published by
+	// autodock. Events without a schema_version predate versioning.
+	SchemaVersion = "1.0"
+)
+
+// ErrDrop is returned by a Handler to stop an event from being handled
+// further, e.g. by a filter, without it being an error
+var ErrDrop = errors.New("event dropped")
+
+// Handler handles events in-process, e.g. as part of the collector's
+// pipeline
 type Handler interface {
 	Handle(message *Message) error
 }
 
-// Message ...
+// HandlerFunc adapts a function to a Handler
+type HandlerFunc func(message *Message) error
+
+// Handle ...
+func (f HandlerFunc) Handle(message *Message) error {
+	return f(message)
+}
+
+// Middleware wraps a Handler to filter, enrich or transform events before
+// passing them on to next, or to stop them by returning ErrDrop
+type Middleware func(next Handler) Handler
+
+// Chain returns h wrapped in middleware so that events pass through each
+// middleware in order before reaching h
+func Chain(h Handler, middleware ...Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// Message is an event as published by autodock: the event received from
+// Docker with the version of the schema and any metadata added by autodock
 type Message struct {
 	etypes.Message
+
+	SchemaVersion string `json:"schema_version,omitempty"`
+
+	// Metadata describes the object the event concerns if the event was
+	// enriched by the collector
+	Metadata *Metadata `json:"metadata,omitempty"`
+}
+
+// NewMessage returns msg as a Message of the current schema version
+func NewMessage(msg etypes.Message) *Message {
+	return &Message{Message: msg, SchemaVersion: SchemaVersion}
+}
+
+// Metadata describes a container or service at the time an event about it
+// was published
+type Metadata struct {
+	Name    string            `json:"name,omitempty"`
+	Image   string            `json:"image,omitempty"`
+	ImageID string            `json:"image_id,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+
+	// State, ExitCode and RestartCount are set for containers
+	State        string `json:"state,omitempty"`
+	ExitCode     *int   `json:"exit_code,omitempty"`
+	RestartCount int    `json:"restart_count,omitempty"`
+
+	// Project and Service are the Compose project and the Compose or
+	// swarm service the container belongs to, if any
+	Project string `json:"project,omitempty"`
+	Service string `json:"service,omitempty"`
+
+	// Replicas is set for replicated services
+	Replicas *uint64 `json:"replicas,omitempty"`
 }
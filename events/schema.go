@@ -0,0 +1,158 @@
+package events
+
+import (
+	"net/http"
+)
+
+// jsonSchema describes events published by autodock in their native
+// format, which is also the data of events published as CloudEvents
+const jsonSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "$id": "https://github.com/prologic/autodock/schema/event/1.0",
+  "title": "autodock event",
+  "description": "An event published by autodock: a Docker event with the version of this schema and optional metadata",
+  "type": "object",
+  "required": ["Type", "Action", "Actor"],
+  "properties": {
+    "schema_version": {
+      "description": "Version of this schema; absent for events published before versioning",
+      "type": "string",
+      "const": "1.0"
+    },
+    "Type": {
+      "description": "Type of object the event concerns; autodock for events generated by autodock; github, hub and registry for webhooks",
+      "type": "string",
+      "enum": ["config", "container", "daemon", "image", "network", "node", "plugin", "secret", "service", "volume", "autodock", "github", "hub", "registry"]
+    },
+    "Action": {
+      "description": "What happened, e.g. create, start, die or exists for objects listed on (re)connecting",
+      "type": "string"
+    },
+    "Actor": {
+      "type": "object",
+      "required": ["ID"],
+      "properties": {
+        "ID": {"description": "ID of the object; the name for volumes", "type": "string"},
+        "Attributes": {
+          "description": "Attributes of the object; labels of containers and images are included",
+          "type": "object",
+          "additionalProperties": {"type": "string"}
+        }
+      }
+    },
+    "scope": {"type": "string", "enum": ["local", "swarm", ""]},
+    "time": {"description": "Unix time in seconds", "type": "integer"},
+    "timeNano": {"description": "Unix time in nanoseconds", "type": "integer"},
+    "status": {"description": "Deprecated by Docker; use Action", "type": "string"},
+    "id": {"description": "Deprecated by Docker; use Actor.ID", "type": "string"},
+    "from": {"description": "Deprecated by Docker; use Actor.Attributes.image", "type": "string"},
+    "metadata": {"$ref": "#/definitions/metadata"}
+  },
+  "allOf": [
+    {
+      "if": {"properties": {"Type": {"const": "container"}}},
+      "then": {
+        "properties": {
+          "Actor": {
+            "properties": {
+              "Attributes": {
+                "properties": {
+                  "name": {"type": "string"},
+                  "image": {"type": "string"},
+                  "exitCode": {"description": "Set on die events", "type": "string", "pattern": "^-?[0-9]+$"},
+                  "signal": {"description": "Set on kill events", "type": "string"}
+                }
+              }
+            }
+          }
+        }
+      }
+    },
+    {
+      "if": {"properties": {"Type": {"const": "network"}}},
+      "then": {
+        "properties": {
+          "Actor": {
+            "properties": {
+              "Attributes": {
+                "properties": {
+                  "name": {"type": "string"},
+                  "type": {"description": "Network driver", "type": "string"},
+                  "container": {"description": "Set on connect and disconnect events", "type": "string"}
+                }
+              }
+            }
+          }
+        }
+      }
+    },
+    {
+      "if": {"properties": {"Type": {"const": "volume"}}},
+      "then": {
+        "properties": {
+          "Actor": {
+            "properties": {
+              "Attributes": {
+                "properties": {
+                  "driver": {"type": "string"},
+                  "container": {"description": "Set on mount and unmount events", "type": "string"},
+                  "destination": {"description": "Set on mount events", "type": "string"}
+                }
+              }
+            }
+          }
+        }
+      }
+    },
+    {
+      "if": {"properties": {"Type": {"enum": ["image", "service", "node", "secret", "config"]}}},
+      "then": {
+        "properties": {
+          "Actor": {
+            "properties": {
+              "Attributes": {
+                "description": "Changed attributes of services and nodes are reported as <name>.old and <name>.new",
+                "properties": {
+                  "name": {"type": "string"}
+                }
+              }
+            }
+          }
+        }
+      }
+    }
+  ],
+  "definitions": {
+    "metadata": {
+      "description": "Metadata about a container or service attached by the collector",
+      "type": "object",
+      "properties": {
+        "name": {"type": "string"},
+        "image": {"type": "string"},
+        "image_id": {"type": "string"},
+        "labels": {"type": "object", "additionalProperties": {"type": "string"}},
+        "state": {"type": "string"},
+        "exit_code": {"type": "integer"},
+        "restart_count": {"type": "integer"},
+        "project": {"description": "Compose project or stack", "type": "string"},
+        "service": {"description": "Compose or swarm service", "type": "string"},
+        "replicas": {"type": "integer", "minimum": 0}
+      }
+    }
+  }
+}
+`
+
+// JSONSchema returns the JSON Schema of events published by autodock so
+// that plugins not written in Go can validate them
+func JSONSchema() []byte {
+	return []byte(jsonSchema)
+}
+
+// SchemaHandler serves the JSON Schema of events
+func SchemaHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/schema+json")
+		w.Write(JSONSchema())
+	})
+}
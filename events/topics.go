@@ -0,0 +1,153 @@
+package events
+
+import (
+	"strings"
+)
+
+const (
+	// TopicSeparator separates the levels of a topic
+	TopicSeparator = "."
+
+	// TopicWildcard matches any single level of a topic
+	TopicWildcard = "*"
+
+	// TopicWildcardRest matches any remaining levels of a topic, including
+	// none, and may only be used as the last level of a pattern
+	TopicWildcardRest = "#"
+
+	// topicLevels is the maximum number of levels of a topic; the last
+	// level is a name which may itself contain separators
+	topicLevels = 3
+)
+
+// Types are the types of events published on the first level of topics
+var Types = []string{
+	"config",
+	"container",
+	"daemon",
+	"image",
+	"network",
+	"node",
+	"plugin",
+	"secret",
+	"service",
+	"volume",
+	AutodockEventType,
+
+	// received by webhooks
+	"github",
+	"hub",
+	"registry",
+}
+
+// Topic returns the most specific topic an event is published on, of the
+// form type.action.name, e.g. container.die.web_1. Levels that are empty
+// are left out. Actions with arguments such as "exec_start: sh" are
+// reduced to the action itself.
+func Topic(m *Message) string {
+	if m.Type == "" {
+		return ""
+	}
+
+	levels := []string{string(m.Type)}
+
+	action := m.Action
+	if i := strings.IndexByte(action, ':'); i >= 0 {
+		action = action[:i]
+	}
+	action = TopicLevel(action)
+	if action == "" {
+		return levels[0]
+	}
+	levels = append(levels, action)
+
+	name := m.Actor.Attributes["name"]
+	if name == "" {
+		name = m.Actor.ID
+	}
+	if name = TopicLevel(name); name != "" {
+		levels = append(levels, name)
+	}
+
+	return strings.Join(levels, TopicSeparator)
+}
+
+// TopicLevel replaces characters that are not safe in a topic, such as
+// whitespace and wildcards, with underscores
+func TopicLevel(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case strings.ContainsRune("_-.:/@", r):
+			return r
+		default:
+			return '_'
+		}
+	}, strings.TrimSpace(s))
+}
+
+// SplitTopic splits topic into its levels; the name level is kept whole
+// even if it contains separators
+func SplitTopic(topic string) []string {
+	return strings.SplitN(topic, TopicSeparator, topicLevels)
+}
+
+// Topics returns topic and each of its parents, least specific first, e.g.
+// container, container.die and container.die.web_1
+func Topics(topic string) []string {
+	levels := SplitTopic(topic)
+
+	topics := make([]string, len(levels))
+	for i := range levels {
+		topics[i] = strings.Join(levels[:i+1], TopicSeparator)
+	}
+	return topics
+}
+
+// MatchTopic reports whether topic matches pattern. A pattern is a topic
+// whose levels may be the wildcard * matching any single level or, as the
+// last level, # matching any remaining levels; e.g. container.*.web_1 or
+// service.#.
+func MatchTopic(pattern, topic string) bool {
+	patterns := SplitTopic(pattern)
+	levels := SplitTopic(topic)
+
+	for i, p := range patterns {
+		if p == TopicWildcardRest && i == len(patterns)-1 {
+			return true
+		}
+		if i >= len(levels) {
+			return false
+		}
+		if p != TopicWildcard && p != levels[i] {
+			return false
+		}
+	}
+
+	return len(patterns) == len(levels)
+}
+
+// MatchTopicOrParent reports whether pattern matches topic or any of its
+// parents
+func MatchTopicOrParent(pattern, topic string) bool {
+	for _, t := range Topics(topic) {
+		if MatchTopic(pattern, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// TopicPrefix returns the levels of pattern before the first wildcard,
+// which is the most specific topic receiving every event pattern matches
+func TopicPrefix(pattern string) string {
+	var levels []string
+	for _, p := range SplitTopic(pattern) {
+		if p == TopicWildcard || p == TopicWildcardRest {
+			break
+		}
+		levels = append(levels, p)
+	}
+	return strings.Join(levels, TopicSeparator)
+}
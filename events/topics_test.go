@@ -0,0 +1,89 @@
+package events
+
+import (
+	"reflect"
+	"testing"
+
+	etypes "github.com/docker/docker/api/types/events"
+)
+
+func TestTopic(t *testing.T) {
+	testCases := []struct {
+		msg      etypes.Message
+		expected string
+	}{
+		{etypes.Message{}, ""},
+		{etypes.Message{Type: "container"}, "container"},
+		{
+			etypes.Message{
+				Type:   "container",
+				Action: "die",
+				Actor:  etypes.Actor{ID: "abc", Attributes: map[string]string{"name": "web_1"}},
+			},
+			"container.die.web_1",
+		},
+		{
+			etypes.Message{
+				Type:   "container",
+				Action: "exec_start: /bin/sh -c true",
+				Actor:  etypes.Actor{ID: "abc", Attributes: map[string]string{"name": "web.1"}},
+			},
+			"container.exec_start.web.1",
+		},
+		{
+			etypes.Message{Type: "volume", Action: "create", Actor: etypes.Actor{ID: "my data"}},
+			"volume.create.my_data",
+		},
+	}
+
+	for _, testCase := range testCases {
+		if actual := Topic(&Message{Message: testCase.msg}); actual != testCase.expected {
+			t.Errorf("expected topic %q; got %q", testCase.expected, actual)
+		}
+	}
+}
+
+func TestTopics(t *testing.T) {
+	expected := []string{"container", "container.die", "container.die.web.1"}
+	if actual := Topics("container.die.web.1"); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected %v; got %v", expected, actual)
+	}
+}
+
+func TestMatchTopic(t *testing.T) {
+	testCases := []struct {
+		pattern  string
+		topic    string
+		expected bool
+	}{
+		{"container", "container", true},
+		{"container", "container.die", false},
+		{"container.die", "container.die", true},
+		{"container.*", "container.die", true},
+		{"container.*", "container.die.web_1", false},
+		{"container.*.web_1", "container.die.web_1", true},
+		{"container.*.web_1", "container.die.web_2", false},
+		{"*.create", "volume.create", true},
+		{"container.#", "container", true},
+		{"container.#", "container.die.web_1", true},
+		{"#", "service.update.app", true},
+		{"container.die.web.1", "container.die.web.1", true},
+	}
+
+	for _, testCase := range testCases {
+		if actual := MatchTopic(testCase.pattern, testCase.topic); actual != testCase.expected {
+			t.Errorf("MatchTopic(%q, %q): expected %v; got %v",
+				testCase.pattern, testCase.topic, testCase.expected, actual)
+		}
+	}
+
+	if !MatchTopicOrParent("container.*", "container.die.web_1") {
+		t.Error("expected pattern to match parent topic")
+	}
+	if prefix := TopicPrefix("container.*.web_1"); prefix != "container" {
+		t.Errorf("expected prefix container; got %q", prefix)
+	}
+	if prefix := TopicPrefix("*.create"); prefix != "" {
+		t.Errorf("expected empty prefix; got %q", prefix)
+	}
+}
@@ -0,0 +1,312 @@
+package events
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// attributes Docker sets on events of each type; any other attributes of
+// container and image events are labels
+var knownAttributes = map[string]map[string]bool{
+	"container": {
+		"name": true, "image": true, "exitCode": true, "signal": true, "execID": true,
+		// set on exists events
+		"state": true, "status": true,
+	},
+	"image": {"name": true},
+}
+
+// Event holds the fields common to all typed events
+type Event struct {
+	ID     string
+	Action string
+	Scope  string
+	Time   time.Time
+}
+
+// ContainerEvent is an event of type container
+type ContainerEvent struct {
+	Event
+
+	Name  string
+	Image string
+
+	// ExitCode is set for die events
+	ExitCode *int
+	// Signal is set for kill events
+	Signal string
+
+	Labels map[string]string
+}
+
+// ImageEvent is an event of type image
+type ImageEvent struct {
+	Event
+
+	Name   string
+	Labels map[string]string
+}
+
+// NetworkEvent is an event of type network
+type NetworkEvent struct {
+	Event
+
+	Name   string
+	Driver string
+
+	// Container is set for connect and disconnect events
+	Container string
+}
+
+// VolumeEvent is an event of type volume. The ID of a volume is its name.
+type VolumeEvent struct {
+	Event
+
+	Driver string
+
+	// Container and Destination are set for mount and unmount events
+	Container   string
+	Destination string
+}
+
+// ServiceEvent is an event of type service. Attributes that changed in an
+// update are reported by Docker as <name>.old and <name>.new, e.g.
+// replicas.new.
+type ServiceEvent struct {
+	Event
+
+	Name    string
+	Changes map[string]Change
+}
+
+// NodeEvent is an event of type node
+type NodeEvent struct {
+	Event
+
+	Name    string
+	Changes map[string]Change
+}
+
+// SecretEvent is an event of type secret
+type SecretEvent struct {
+	Event
+
+	Name string
+}
+
+// ConfigEvent is an event of type config
+type ConfigEvent struct {
+	Event
+
+	Name string
+}
+
+// Change is the old and new value of an attribute of a service or node
+type Change struct {
+	Old string
+	New string
+}
+
+func (m *Message) event() Event {
+	e := Event{ID: m.Actor.ID, Action: m.Action, Scope: m.Scope}
+	if m.TimeNano > 0 {
+		e.Time = time.Unix(0, m.TimeNano)
+	} else if m.Time > 0 {
+		e.Time = time.Unix(m.Time, 0)
+	}
+	return e
+}
+
+func (m *Message) attribute(key string) string {
+	return m.Actor.Attributes[key]
+}
+
+// changes collects attributes named <name>.old and <name>.new
+func (m *Message) changes() map[string]Change {
+	changes := make(map[string]Change)
+	for key, value := range m.Actor.Attributes {
+		switch {
+		case strings.HasSuffix(key, ".old"):
+			name := strings.TrimSuffix(key, ".old")
+			change := changes[name]
+			change.Old = value
+			changes[name] = change
+		case strings.HasSuffix(key, ".new"):
+			name := strings.TrimSuffix(key, ".new")
+			change := changes[name]
+			change.New = value
+			changes[name] = change
+		}
+	}
+	return changes
+}
+
+// ContainerEvent returns the event as a ContainerEvent if it is of type container
+func (m *Message) ContainerEvent() (*ContainerEvent, bool) {
+	if m.Type != "container" {
+		return nil, false
+	}
+
+	e := &ContainerEvent{
+		Event:  m.event(),
+		Name:   m.Name(),
+		Image:  m.Image(),
+		Signal: m.attribute("signal"),
+		Labels: m.Labels(),
+	}
+	if code, ok := m.ExitCode(); ok {
+		e.ExitCode = &code
+	}
+	return e, true
+}
+
+// ImageEvent returns the event as an ImageEvent if it is of type image
+func (m *Message) ImageEvent() (*ImageEvent, bool) {
+	if m.Type != "image" {
+		return nil, false
+	}
+
+	return &ImageEvent{Event: m.event(), Name: m.Name(), Labels: m.Labels()}, true
+}
+
+// NetworkEvent returns the event as a NetworkEvent if it is of type network
+func (m *Message) NetworkEvent() (*NetworkEvent, bool) {
+	if m.Type != "network" {
+		return nil, false
+	}
+
+	return &NetworkEvent{
+		Event:     m.event(),
+		Name:      m.Name(),
+		Driver:    m.attribute("type"),
+		Container: m.attribute("container"),
+	}, true
+}
+
+// VolumeEvent returns the event as a VolumeEvent if it is of type volume
+func (m *Message) VolumeEvent() (*VolumeEvent, bool) {
+	if m.Type != "volume" {
+		return nil, false
+	}
+
+	return &VolumeEvent{
+		Event:       m.event(),
+		Driver:      m.attribute("driver"),
+		Container:   m.attribute("container"),
+		Destination: m.attribute("destination"),
+	}, true
+}
+
+// ServiceEvent returns the event as a ServiceEvent if it is of type service
+func (m *Message) ServiceEvent() (*ServiceEvent, bool) {
+	if m.Type != "service" {
+		return nil, false
+	}
+
+	return &ServiceEvent{Event: m.event(), Name: m.Name(), Changes: m.changes()}, true
+}
+
+// NodeEvent returns the event as a NodeEvent if it is of type node
+func (m *Message) NodeEvent() (*NodeEvent, bool) {
+	if m.Type != "node" {
+		return nil, false
+	}
+
+	return &NodeEvent{Event: m.event(), Name: m.Name(), Changes: m.changes()}, true
+}
+
+// SecretEvent returns the event as a SecretEvent if it is of type secret
+func (m *Message) SecretEvent() (*SecretEvent, bool) {
+	if m.Type != "secret" {
+		return nil, false
+	}
+
+	return &SecretEvent{Event: m.event(), Name: m.Name()}, true
+}
+
+// ConfigEvent returns the event as a ConfigEvent if it is of type config
+func (m *Message) ConfigEvent() (*ConfigEvent, bool) {
+	if m.Type != "config" {
+		return nil, false
+	}
+
+	return &ConfigEvent{Event: m.event(), Name: m.Name()}, true
+}
+
+// Name returns the name of the object the event concerns, e.g. the name
+// of a container or an image reference, or its ID if it has no name
+func (m *Message) Name() string {
+	if name := m.attribute("name"); name != "" {
+		return name
+	}
+	if m.Metadata != nil && m.Metadata.Name != "" {
+		return m.Metadata.Name
+	}
+	return m.Actor.ID
+}
+
+// Image returns the image of a container or service event
+func (m *Message) Image() string {
+	if image := m.attribute("image"); image != "" {
+		return image
+	}
+	if image := m.attribute("image.new"); image != "" {
+		return image
+	}
+	if m.Metadata != nil {
+		return m.Metadata.Image
+	}
+	return ""
+}
+
+// ExitCode returns the exit code of a container and whether it is known,
+// i.e. the event is a die event or was enriched with the exit code
+func (m *Message) ExitCode() (int, bool) {
+	if code, err := strconv.Atoi(m.attribute("exitCode")); err == nil {
+		return code, true
+	}
+	if m.Metadata != nil && m.Metadata.ExitCode != nil {
+		return *m.Metadata.ExitCode, true
+	}
+	return 0, false
+}
+
+// ServiceName returns the name of the swarm or Compose service of a
+// service or container event
+func (m *Message) ServiceName() string {
+	switch m.Type {
+	case "service":
+		return m.Name()
+	case "container":
+		for _, key := range []string{"com.docker.swarm.service.name", "com.docker.compose.service"} {
+			if name := m.attribute(key); name != "" {
+				return name
+			}
+		}
+	}
+	if m.Metadata != nil {
+		return m.Metadata.Service
+	}
+	return ""
+}
+
+// Labels returns the labels of the container or image the event concerns
+func (m *Message) Labels() map[string]string {
+	if m.Metadata != nil && m.Metadata.Labels != nil {
+		return m.Metadata.Labels
+	}
+
+	known, ok := knownAttributes[m.Type]
+	if !ok {
+		return nil
+	}
+
+	labels := make(map[string]string)
+	for key, value := range m.Actor.Attributes {
+		if !known[key] {
+			labels[key] = value
+		}
+	}
+	return labels
+}
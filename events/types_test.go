@@ -0,0 +1,87 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+
+	etypes "github.com/docker/docker/api/types/events"
+)
+
+func TestContainerEvent(t *testing.T) {
+	m := NewMessage(etypes.Message{
+		Type:   "container",
+		Action: "die",
+		Actor: etypes.Actor{
+			ID: "abc",
+			Attributes: map[string]string{
+				"name":                       "web_1",
+				"image":                      "nginx",
+				"exitCode":                   "1",
+				"com.docker.compose.service": "web",
+			},
+		},
+		TimeNano: 1,
+	})
+
+	if m.SchemaVersion != SchemaVersion {
+		t.Errorf("expected schema version %s; got %q", SchemaVersion, m.SchemaVersion)
+	}
+
+	e, ok := m.ContainerEvent()
+	if !ok {
+		t.Fatal("expected container event")
+	}
+	if e.ID != "abc" || e.Name != "web_1" || e.Image != "nginx" || e.Time.UnixNano() != 1 {
+		t.Errorf("unexpected container event: %+v", e)
+	}
+	if e.ExitCode == nil || *e.ExitCode != 1 {
+		t.Errorf("expected exit code 1; got %v", e.ExitCode)
+	}
+	if len(e.Labels) != 1 || e.Labels["com.docker.compose.service"] != "web" {
+		t.Errorf("unexpected labels: %v", e.Labels)
+	}
+	if name := m.ServiceName(); name != "web" {
+		t.Errorf("expected service name web; got %q", name)
+	}
+
+	if _, ok := m.ServiceEvent(); ok {
+		t.Error("expected container event not to be a service event")
+	}
+}
+
+func TestServiceEvent(t *testing.T) {
+	m := NewMessage(etypes.Message{
+		Type:   "service",
+		Action: "update",
+		Actor: etypes.Actor{
+			ID: "xyz",
+			Attributes: map[string]string{
+				"name":         "app",
+				"replicas.old": "1",
+				"replicas.new": "3",
+				"image.new":    "app:2",
+			},
+		},
+	})
+
+	e, ok := m.ServiceEvent()
+	if !ok {
+		t.Fatal("expected service event")
+	}
+	if e.Name != "app" || m.ServiceName() != "app" || m.Image() != "app:2" {
+		t.Errorf("unexpected service event: %+v", e)
+	}
+	if c := e.Changes["replicas"]; c.Old != "1" || c.New != "3" {
+		t.Errorf("unexpected replicas change: %+v", c)
+	}
+	if _, ok := m.ExitCode(); ok {
+		t.Error("expected no exit code for service event")
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	var schema map[string]interface{}
+	if err := json.Unmarshal(JSONSchema(), &schema); err != nil {
+		t.Fatalf("invalid JSON schema: %s", err)
+	}
+}
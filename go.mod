@@ -1,13 +1,19 @@
 module github.com/prologic/autodock
 
+go 1.12
+
 require (
+	github.com/BurntSushi/toml v0.3.0
+	github.com/alicebob/miniredis/v2 v2.23.0
 	github.com/docker/distribution v2.7.0+incompatible // indirect
 	github.com/docker/docker v0.7.3-0.20190111153827-295413c9d0e1
 	github.com/docker/go-connections v0.4.0 // indirect
 	github.com/docker/go-units v0.3.3 // indirect
+	github.com/eclipse/paho.mqtt.golang v1.2.0
 	github.com/gogo/protobuf v1.2.0 // indirect
+	github.com/gomodule/redigo v1.8.2
 	github.com/gorilla/websocket v1.4.0 // indirect
-	github.com/jpillora/backoff v0.0.0-20180909062703-3050d21c67d7 // indirect
+	github.com/jpillora/backoff v0.0.0-20180909062703-3050d21c67d7
 	github.com/namsral/flag v1.7.4-pre
 	github.com/opencontainers/go-digest v1.0.0-rc1 // indirect
 	github.com/opencontainers/image-spec v1.0.1 // indirect
@@ -18,4 +24,5 @@ require (
 	github.com/unrolled/logger v0.0.0-20180528161137-f2fe13954c71
 	golang.org/x/crypto v0.0.0-20181203042331-505ab145d0a9 // indirect
 	golang.org/x/net v0.0.0-20181220203305-927f97764cc3
+	gopkg.in/yaml.v2 v2.2.2
 )
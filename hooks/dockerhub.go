@@ -0,0 +1,140 @@
+package hooks
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/prologic/autodock/collector"
+)
+
+// callbackHost is the only host Docker Hub callbacks are sent to so that
+// a forged callback_url cannot make autodock send requests elsewhere
+const callbackHost = "registry.hub.docker.com"
+
+// dockerHubPayload is the payload of a Docker Hub webhook
+type dockerHubPayload struct {
+	CallbackURL string `json:"callback_url"`
+	PushData    struct {
+		PushedAt int64  `json:"pushed_at"`
+		Pusher   string `json:"pusher"`
+		Tag      string `json:"tag"`
+	} `json:"push_data"`
+	Repository struct {
+		RepoName  string `json:"repo_name"`
+		RepoURL   string `json:"repo_url"`
+		Namespace string `json:"namespace"`
+		Name      string `json:"name"`
+	} `json:"repository"`
+}
+
+// DockerHub receives Docker Hub webhooks and publishes them as hub push
+// events, e.g. on hub.push.prologic/autodock. Docker Hub does not sign
+// webhooks so requests must include the configured token as ?token=.
+type DockerHub struct {
+	publisher collector.Publisher
+	token     string
+	callback  bool
+	client    *http.Client
+}
+
+// NewDockerHub ...
+func NewDockerHub(publisher collector.Publisher, token string, callback bool) *DockerHub {
+	return &DockerHub{
+		publisher: publisher,
+		token:     token,
+		callback:  callback,
+		client:    &http.Client{Timeout: time.Second * 10},
+	}
+}
+
+func (h *DockerHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := readBody(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var payload dockerHubPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		http.Error(w, fmt.Sprintf("error decoding payload: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	repo := payload.Repository.RepoName
+	if repo == "" {
+		http.Error(w, "missing repository", http.StatusBadRequest)
+		return
+	}
+
+	tag := payload.PushData.Tag
+	if tag == "" {
+		tag = "latest"
+	}
+
+	attributes := map[string]string{
+		"name":     repo,
+		"image":    fmt.Sprintf("%s:%s", repo, tag),
+		"tag":      tag,
+		"pusher":   payload.PushData.Pusher,
+		"repo_url": payload.Repository.RepoURL,
+	}
+	if payload.PushData.PushedAt > 0 {
+		attributes["pushed_at"] = strconv.FormatInt(payload.PushData.PushedAt, 10)
+	}
+
+	if err := publish(h.publisher, HubEventType, "push", repo, attributes); err != nil {
+		log.Error(err)
+		h.confirm(payload.CallbackURL, false)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.confirm(payload.CallbackURL, true)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// confirm reports to Docker Hub whether the webhook was handled
+func (h *DockerHub) confirm(callbackURL string, ok bool) {
+	if !h.callback || callbackURL == "" {
+		return
+	}
+
+	u, err := url.Parse(callbackURL)
+	if err != nil || u.Scheme != "https" || u.Host != callbackHost {
+		log.Warnf("not confirming Docker Hub webhook to untrusted callback %q", callbackURL)
+		return
+	}
+
+	state, description := "success", "received by autodock"
+	if !ok {
+		state, description = "error", "autodock failed to publish the event"
+	}
+	body, _ := json.Marshal(map[string]string{
+		"state":       state,
+		"description": description,
+		"context":     "autodock",
+	})
+
+	go func() {
+		res, err := h.client.Post(u.String(), "application/json", bytes.NewReader(body))
+		if err != nil {
+			log.Errorf("error confirming Docker Hub webhook: %s", err)
+			return
+		}
+		res.Body.Close()
+	}()
+}
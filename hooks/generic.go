@@ -0,0 +1,199 @@
+package hooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/prologic/autodock/collector"
+	"github.com/prologic/autodock/config"
+	"github.com/prologic/autodock/events"
+)
+
+// placeholder matches {path} in topic templates
+var placeholder = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// Generic receives webhooks on /hooks/<name> from any of the configured
+// sources and publishes their JSON payloads as is
+type Generic struct {
+	publisher collector.Publisher
+	sources   map[string]config.HookSourceConfig
+}
+
+// NewGeneric ...
+func NewGeneric(publisher collector.Publisher, sources []config.HookSourceConfig) *Generic {
+	h := &Generic{
+		publisher: publisher,
+		sources:   make(map[string]config.HookSourceConfig),
+	}
+	for _, source := range sources {
+		h.sources[source.Name] = source
+	}
+	return h
+}
+
+func (h *Generic) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/hooks/"), "/")
+	source, ok := h.sources[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, err := readBody(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := authenticate(source, r, body); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var payload interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		http.Error(w, fmt.Sprintf("error decoding payload: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	for _, path := range source.Require {
+		if _, ok := lookup(payload, path); !ok {
+			http.Error(w, fmt.Sprintf("payload is missing %s", path), http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	topic, err := mapTopic(source, payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if err := h.publisher.Publish(topic, body); err != nil {
+		log.Errorf("error publishing hook %s on %s: %s", name, topic, err)
+		http.Error(w, "error publishing event", http.StatusInternalServerError)
+		return
+	}
+
+	log.Debugf("published %s hook on %s", name, topic)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// authenticate checks a request carries the source's secret or is signed
+// with it
+func authenticate(source config.HookSourceConfig, r *http.Request, body []byte) error {
+	switch source.Auth {
+	case config.HookAuthToken:
+		header := source.Header
+		if header == "" {
+			header = "Authorization"
+		}
+
+		token := r.Header.Get(header)
+		token = strings.TrimPrefix(token, "Bearer ")
+		if token == "" {
+			token = r.URL.Query().Get("token")
+		}
+
+		if subtle.ConstantTimeCompare([]byte(token), []byte(source.Secret)) != 1 {
+			return fmt.Errorf("invalid token")
+		}
+	case config.HookAuthHMAC:
+		header := source.Header
+		if header == "" {
+			header = "X-Signature"
+		}
+
+		expected, err := hex.DecodeString(strings.TrimPrefix(r.Header.Get(header), "sha256="))
+		if err != nil || len(expected) == 0 {
+			return fmt.Errorf("missing or invalid signature")
+		}
+
+		mac := hmac.New(sha256.New, []byte(source.Secret))
+		mac.Write(body)
+		if !hmac.Equal(mac.Sum(nil), expected) {
+			return fmt.Errorf("invalid signature")
+		}
+	default:
+		return fmt.Errorf("unsupported auth %q", source.Auth)
+	}
+
+	return nil
+}
+
+// mapTopic returns the topic a payload is published on, replacing each
+// {path} in the source's topic with the value at path in the payload.
+// Separators in values are replaced so that each value is a single level.
+func mapTopic(source config.HookSourceConfig, payload interface{}) (string, error) {
+	if source.Topic == "" {
+		return "hook" + events.TopicSeparator + source.Name, nil
+	}
+
+	var err error
+	topic := placeholder.ReplaceAllStringFunc(source.Topic, func(match string) string {
+		path := match[1 : len(match)-1]
+		value, ok := lookup(payload, path)
+		if !ok {
+			err = fmt.Errorf("payload is missing %s for topic", path)
+			return ""
+		}
+		return strings.Replace(events.TopicLevel(value), events.TopicSeparator, "_", -1)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	for _, level := range strings.Split(topic, events.TopicSeparator) {
+		if level == "" {
+			return "", fmt.Errorf("topic %q has an empty level", topic)
+		}
+	}
+
+	return topic, nil
+}
+
+// lookup returns the value at a dotted path in a decoded JSON value, e.g.
+// alerts.0.labels.alertname, formatted as a string
+func lookup(v interface{}, path string) (string, bool) {
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			value, ok := node[key]
+			if !ok {
+				return "", false
+			}
+			v = value
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return "", false
+			}
+			v = node[i]
+		default:
+			return "", false
+		}
+	}
+
+	switch value := v.(type) {
+	case nil:
+		return "", false
+	case string:
+		return value, true
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(value)
+		return string(data), true
+	default:
+		return fmt.Sprint(value), true
+	}
+}
@@ -0,0 +1,150 @@
+package hooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/prologic/autodock/collector"
+)
+
+// gitHubPayload holds the fields of GitHub webhook payloads used to build
+// events; push events are described in most detail
+type gitHubPayload struct {
+	Ref     string `json:"ref"`
+	Before  string `json:"before"`
+	After   string `json:"after"`
+	Deleted bool   `json:"deleted"`
+	Pusher  struct {
+		Name string `json:"name"`
+	} `json:"pusher"`
+	Sender struct {
+		Login string `json:"login"`
+	} `json:"sender"`
+	Repository struct {
+		FullName string `json:"full_name"`
+		HTMLURL  string `json:"html_url"`
+	} `json:"repository"`
+	HeadCommit struct {
+		Message string `json:"message"`
+	} `json:"head_commit"`
+}
+
+// GitHub receives GitHub webhooks signed with a shared secret and
+// publishes them as github events named after the GitHub event, e.g. on
+// github.push.prologic/autodock. Pings are acknowledged but not published.
+type GitHub struct {
+	publisher collector.Publisher
+	secret    []byte
+}
+
+// NewGitHub ...
+func NewGitHub(publisher collector.Publisher, secret string) *GitHub {
+	return &GitHub{publisher: publisher, secret: []byte(secret)}
+}
+
+func (h *GitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := readBody(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.verify(r, body); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	event := r.Header.Get("X-GitHub-Event")
+	switch event {
+	case "":
+		http.Error(w, "missing X-GitHub-Event header", http.StatusBadRequest)
+		return
+	case "ping":
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var payload gitHubPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		http.Error(w, fmt.Sprintf("error decoding payload: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	repo := payload.Repository.FullName
+	if repo == "" {
+		http.Error(w, "missing repository", http.StatusBadRequest)
+		return
+	}
+
+	attributes := map[string]string{
+		"name":     repo,
+		"repo_url": payload.Repository.HTMLURL,
+		"sender":   payload.Sender.Login,
+		"delivery": r.Header.Get("X-GitHub-Delivery"),
+	}
+	if event == "push" {
+		attributes["ref"] = payload.Ref
+		attributes["before"] = payload.Before
+		attributes["after"] = payload.After
+		attributes["pusher"] = payload.Pusher.Name
+		attributes["message"] = payload.HeadCommit.Message
+		attributes["deleted"] = fmt.Sprint(payload.Deleted)
+		switch {
+		case strings.HasPrefix(payload.Ref, "refs/heads/"):
+			attributes["branch"] = strings.TrimPrefix(payload.Ref, "refs/heads/")
+		case strings.HasPrefix(payload.Ref, "refs/tags/"):
+			attributes["tag"] = strings.TrimPrefix(payload.Ref, "refs/tags/")
+		}
+	}
+
+	if err := publish(h.publisher, GitHubEventType, event, repo, attributes); err != nil {
+		log.Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// verify checks the signature of body in the X-Hub-Signature-256 header,
+// or the legacy X-Hub-Signature header if the former is missing
+func (h *GitHub) verify(r *http.Request, body []byte) error {
+	var (
+		prefix    string
+		newHash   func() hash.Hash
+		signature = r.Header.Get("X-Hub-Signature-256")
+	)
+
+	if signature != "" {
+		prefix, newHash = "sha256=", sha256.New
+	} else if signature = r.Header.Get("X-Hub-Signature"); signature != "" {
+		prefix, newHash = "sha1=", sha1.New
+	} else {
+		return fmt.Errorf("missing signature")
+	}
+
+	if !strings.HasPrefix(signature, prefix) {
+		return fmt.Errorf("invalid signature")
+	}
+	expected, err := hex.DecodeString(strings.TrimPrefix(signature, prefix))
+	if err != nil {
+		return fmt.Errorf("invalid signature")
+	}
+
+	mac := hmac.New(newHash, h.secret)
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return fmt.Errorf("invalid signature")
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+// Package hooks implements endpoints receiving webhooks from external
+// services such as Docker Hub and GitHub and publishing them as autodock
+// events so that plugins can react to them, e.g. by redeploying a service
+// when a new image is pushed.
+package hooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	etypes "github.com/docker/docker/api/types/events"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/prologic/autodock/collector"
+	"github.com/prologic/autodock/events"
+)
+
+const (
+	// HubEventType is the type of events received from Docker Hub
+	HubEventType = "hub"
+
+	// GitHubEventType is the type of events received from GitHub
+	GitHubEventType = "github"
+
+	// maxBodySize is the maximum size of a webhook payload
+	maxBodySize = 1 << 20
+)
+
+// readBody reads the body of a webhook request up to maxBodySize
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	if r.Method != http.MethodPost {
+		return nil, fmt.Errorf("method %s not allowed", r.Method)
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		return nil, fmt.Errorf("error reading body: %s", err)
+	}
+
+	return body, nil
+}
+
+// publish publishes an event of type typ concerning id
+func publish(publisher collector.Publisher, typ, action, id string, attributes map[string]string) error {
+	now := time.Now()
+	e := events.NewMessage(etypes.Message{
+		Type:     typ,
+		Action:   action,
+		Actor:    etypes.Actor{ID: id, Attributes: attributes},
+		Time:     now.Unix(),
+		TimeNano: now.UnixNano(),
+	})
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("error encoding event: %s", err)
+	}
+
+	topic := events.Topic(e)
+	if err := publisher.Publish(topic, payload); err != nil {
+		return fmt.Errorf("error publishing event %s: %s", topic, err)
+	}
+
+	log.Debugf("published webhook event %s", topic)
+
+	return nil
+}
@@ -0,0 +1,229 @@
+package hooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/prologic/autodock/config"
+	"github.com/prologic/autodock/events"
+)
+
+type recordingPublisher struct {
+	sync.Mutex
+	topics   []string
+	messages []*events.Message
+}
+
+func (p *recordingPublisher) Publish(topic string, payload []byte) error {
+	p.Lock()
+	defer p.Unlock()
+
+	var m events.Message
+	json.Unmarshal(payload, &m)
+	p.topics = append(p.topics, topic)
+	p.messages = append(p.messages, &m)
+	return nil
+}
+
+const dockerHubPayloadJSON = `{
+  "callback_url": "https://registry.hub.docker.com/u/prologic/autodock/hook/1/",
+  "push_data": {"pushed_at": 1546300800, "pusher": "prologic", "tag": "v1.0"},
+  "repository": {"repo_name": "prologic/autodock", "namespace": "prologic", "name": "autodock"}
+}`
+
+func TestDockerHub(t *testing.T) {
+	publisher := &recordingPublisher{}
+	h := NewDockerHub(publisher, "s3cret", false)
+
+	testCases := []struct {
+		url      string
+		body     string
+		expected int
+	}{
+		{"/hooks/dockerhub", dockerHubPayloadJSON, http.StatusUnauthorized},
+		{"/hooks/dockerhub?token=wrong", dockerHubPayloadJSON, http.StatusUnauthorized},
+		{"/hooks/dockerhub?token=s3cret", "{", http.StatusBadRequest},
+		{"/hooks/dockerhub?token=s3cret", dockerHubPayloadJSON, http.StatusAccepted},
+	}
+
+	for _, testCase := range testCases {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("POST", testCase.url, strings.NewReader(testCase.body)))
+		if w.Code != testCase.expected {
+			t.Errorf("%s: expected status %d; got %d", testCase.url, testCase.expected, w.Code)
+		}
+	}
+
+	if len(publisher.topics) != 1 || publisher.topics[0] != "hub.push.prologic/autodock" {
+		t.Fatalf("unexpected topics published: %v", publisher.topics)
+	}
+	m := publisher.messages[0]
+	if m.Image() != "prologic/autodock:v1.0" || m.Actor.Attributes["pusher"] != "prologic" {
+		t.Errorf("unexpected event: %+v", m)
+	}
+}
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestGitHub(t *testing.T) {
+	body := `{
+	  "ref": "refs/heads/master",
+	  "after": "abc123",
+	  "pusher": {"name": "prologic"},
+	  "repository": {"full_name": "prologic/autodock"}
+	}`
+
+	publisher := &recordingPublisher{}
+	h := NewGitHub(publisher, "s3cret")
+
+	testCases := []struct {
+		event     string
+		signature string
+		expected  int
+	}{
+		{"push", "", http.StatusUnauthorized},
+		{"push", sign("wrong", body), http.StatusUnauthorized},
+		{"ping", sign("s3cret", body), http.StatusOK},
+		{"push", sign("s3cret", body), http.StatusAccepted},
+	}
+
+	for _, testCase := range testCases {
+		r := httptest.NewRequest("POST", "/hooks/github", strings.NewReader(body))
+		r.Header.Set("X-GitHub-Event", testCase.event)
+		if testCase.signature != "" {
+			r.Header.Set("X-Hub-Signature-256", testCase.signature)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != testCase.expected {
+			t.Errorf("%s %q: expected status %d; got %d",
+				testCase.event, testCase.signature, testCase.expected, w.Code)
+		}
+	}
+
+	if len(publisher.topics) != 1 || publisher.topics[0] != "github.push.prologic/autodock" {
+		t.Fatalf("unexpected topics published: %v", publisher.topics)
+	}
+	m := publisher.messages[0]
+	if m.Actor.Attributes["branch"] != "master" || m.Actor.Attributes["after"] != "abc123" {
+		t.Errorf("unexpected event attributes: %v", m.Actor.Attributes)
+	}
+}
+
+func TestGeneric(t *testing.T) {
+	alert := `{"status": "firing", "commonLabels": {"alertname": "High CPU"}, "alerts": [{"fingerprint": "f00"}]}`
+
+	publisher := &recordingPublisher{}
+	h := NewGeneric(publisher, []config.HookSourceConfig{
+		{
+			Name:    "alertmanager",
+			Auth:    config.HookAuthToken,
+			Secret:  "s3cret",
+			Topic:   "alertmanager.{status}.{commonLabels.alertname}",
+			Require: []string{"alerts.0.fingerprint"},
+		},
+		{Name: "ci", Auth: config.HookAuthHMAC, Secret: "s3cret"},
+	})
+
+	testCases := []struct {
+		url      string
+		header   string
+		value    string
+		body     string
+		expected int
+	}{
+		{"/hooks/unknown", "", "", alert, http.StatusNotFound},
+		{"/hooks/alertmanager", "Authorization", "Bearer wrong", alert, http.StatusUnauthorized},
+		{"/hooks/alertmanager", "Authorization", "Bearer s3cret", `{"status": "firing"}`, http.StatusUnprocessableEntity},
+		{"/hooks/alertmanager?token=s3cret", "", "", alert, http.StatusAccepted},
+		{"/hooks/alertmanager?token=s3cret", "", "", strings.Replace(alert, `"firing"`, `"firing.x"`, 1), http.StatusAccepted},
+		{"/hooks/alertmanager?token=s3cret", "", "", strings.Replace(alert, `"firing"`, `" "`, 1), http.StatusUnprocessableEntity},
+		{"/hooks/ci", "X-Signature", sign("wrong", `{}`), `{}`, http.StatusUnauthorized},
+		{"/hooks/ci", "X-Signature", sign("s3cret", `{}`), `{}`, http.StatusAccepted},
+	}
+
+	for _, testCase := range testCases {
+		r := httptest.NewRequest("POST", testCase.url, strings.NewReader(testCase.body))
+		if testCase.header != "" {
+			r.Header.Set(testCase.header, testCase.value)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != testCase.expected {
+			t.Errorf("%s: expected status %d; got %d", testCase.url, testCase.expected, w.Code)
+		}
+	}
+
+	expected := []string{"alertmanager.firing.High_CPU", "alertmanager.firing_x.High_CPU", "hook.ci"}
+	if !reflect.DeepEqual(publisher.topics, expected) {
+		t.Fatalf("expected topics %v; got %v", expected, publisher.topics)
+	}
+}
+
+const registryNotification = `{"events": [
+  {
+    "id": "e1",
+    "action": "push",
+    "target": {
+      "mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+      "digest": "sha256:abc",
+      "repository": "myapp",
+      "url": "https://registry.example.com/v2/myapp/manifests/sha256:abc",
+      "tag": "v2"
+    }
+  },
+  {
+    "id": "e2",
+    "action": "push",
+    "target": {"mediaType": "application/octet-stream", "digest": "sha256:def", "repository": "myapp"}
+  },
+  {
+    "id": "e3",
+    "action": "pull",
+    "target": {"mediaType": "application/vnd.docker.distribution.manifest.v2+json", "repository": "myapp"}
+  }
+]}`
+
+func TestRegistry(t *testing.T) {
+	publisher := &recordingPublisher{}
+	h := NewRegistry(publisher, "s3cret", []string{"push", "delete"})
+
+	for i, token := range []string{"wrong", "s3cret", "s3cret"} {
+		r := httptest.NewRequest("POST", "/hooks/registry", strings.NewReader(registryNotification))
+		r.Header.Set("Authorization", "Bearer "+token)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		expected := http.StatusOK
+		if i == 0 {
+			expected = http.StatusUnauthorized
+		}
+		if w.Code != expected {
+			t.Errorf("delivery %d: expected status %d; got %d", i, expected, w.Code)
+		}
+	}
+
+	// the blob push and pull are discarded and the redelivery deduplicated
+	if len(publisher.topics) != 1 || publisher.topics[0] != "registry.push.myapp" {
+		t.Fatalf("unexpected topics published: %v", publisher.topics)
+	}
+	m := publisher.messages[0]
+	if m.Image() != "registry.example.com/myapp:v2" || m.Actor.Attributes["digest"] != "sha256:abc" {
+		t.Errorf("unexpected event attributes: %v", m.Actor.Attributes)
+	}
+}
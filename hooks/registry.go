@@ -0,0 +1,151 @@
+package hooks
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/prologic/autodock/collector"
+	"github.com/prologic/autodock/recent"
+)
+
+const (
+	// RegistryEventType is the type of events received from a registry
+	RegistryEventType = "registry"
+
+	// registryRecentEvents is the number of event IDs remembered to
+	// discard notifications the registry delivers more than once
+	registryRecentEvents = 1024
+)
+
+// registryEnvelope is a Docker Registry v2 notification
+type registryEnvelope struct {
+	Events []registryEvent `json:"events"`
+}
+
+type registryEvent struct {
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Action    string    `json:"action"`
+	Target    struct {
+		MediaType  string `json:"mediaType"`
+		Digest     string `json:"digest"`
+		Size       int64  `json:"size"`
+		Repository string `json:"repository"`
+		URL        string `json:"url"`
+		Tag        string `json:"tag"`
+	} `json:"target"`
+	Request struct {
+		Host string `json:"host"`
+	} `json:"request"`
+	Actor struct {
+		Name string `json:"name"`
+	} `json:"actor"`
+}
+
+// Registry receives notifications from a Docker Registry v2 and publishes
+// them as registry events, e.g. on registry.push.myapp. Only events for
+// manifests are published; blob (layer) events are discarded. Events
+// delivered more than once are published once.
+type Registry struct {
+	publisher collector.Publisher
+	token     string
+	actions   map[string]bool
+	recent    *recent.Set
+}
+
+// NewRegistry ...
+func NewRegistry(publisher collector.Publisher, token string, actions []string) *Registry {
+	h := &Registry{
+		publisher: publisher,
+		token:     token,
+		actions:   make(map[string]bool),
+		recent:    recent.NewSet(registryRecentEvents),
+	}
+	for _, action := range actions {
+		h.actions[action] = true
+	}
+	return h
+}
+
+func (h *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := readBody(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var envelope registryEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		http.Error(w, fmt.Sprintf("error decoding notification: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	for _, e := range envelope.Events {
+		if !h.actions[e.Action] || !strings.Contains(e.Target.MediaType, "manifest") {
+			continue
+		}
+		if e.ID != "" && !h.recent.Add(e.ID) {
+			log.Debugf("discarding duplicate registry event %s", e.ID)
+			continue
+		}
+
+		if err := publish(h.publisher, RegistryEventType, e.Action, e.Target.Repository, registryAttributes(e)); err != nil {
+			log.Error(err)
+			// the registry retries failed deliveries, so allow the event
+			// to be published again
+			h.recent.Remove(e.ID)
+			http.Error(w, "error publishing event", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func registryAttributes(e registryEvent) map[string]string {
+	attributes := map[string]string{
+		"name":       e.Target.Repository,
+		"event_id":   e.ID,
+		"digest":     e.Target.Digest,
+		"media_type": e.Target.MediaType,
+		"tag":        e.Target.Tag,
+		"actor":      e.Actor.Name,
+	}
+	if e.Target.Size > 0 {
+		attributes["size"] = strconv.FormatInt(e.Target.Size, 10)
+	}
+
+	// the host clients pull from is that of the target's URL
+	host := e.Request.Host
+	if u, err := url.Parse(e.Target.URL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	attributes["host"] = host
+
+	image := e.Target.Repository
+	if host != "" {
+		image = host + "/" + image
+	}
+	switch {
+	case e.Target.Tag != "":
+		attributes["image"] = image + ":" + e.Target.Tag
+	case e.Target.Digest != "":
+		attributes["image"] = image + "@" + e.Target.Digest
+	}
+
+	return attributes
+}
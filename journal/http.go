@@ -0,0 +1,74 @@
+package journal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ParseQuery parses a Query from the "seq", "since", "topic" and "limit"
+// URL query parameters. since is either RFC3339 or a Unix timestamp.
+func ParseQuery(r *http.Request) (Query, error) {
+	var (
+		q   Query
+		err error
+	)
+
+	values := r.URL.Query()
+
+	if seq := values.Get("seq"); seq != "" {
+		q.Seq, err = strconv.ParseUint(seq, 10, 64)
+		if err != nil {
+			return q, fmt.Errorf("invalid seq %q", seq)
+		}
+	}
+
+	if since := values.Get("since"); since != "" {
+		if unix, err := strconv.ParseInt(since, 10, 64); err == nil {
+			q.Since = time.Unix(unix, 0)
+		} else if q.Since, err = time.Parse(time.RFC3339Nano, since); err != nil {
+			return q, fmt.Errorf("invalid since %q", since)
+		}
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		q.Limit, err = strconv.Atoi(limit)
+		if err != nil || q.Limit < 0 {
+			return q, fmt.Errorf("invalid limit %q", limit)
+		}
+	}
+
+	q.Topic = values.Get("topic")
+
+	return q, nil
+}
+
+// ServeHTTP replays the journal entries selected by the request's query
+// parameters (see ParseQuery) as a stream of JSON lines.
+func (j *Journal) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q, err := ParseQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("X-Journal-Seq", strconv.FormatUint(j.Seq(), 10))
+
+	enc := json.NewEncoder(w)
+	err = j.Replay(q, func(e *Entry) error {
+		return enc.Encode(e)
+	})
+	if err != nil {
+		log.Errorf("error replaying journal: %s", err)
+	}
+}
@@ -0,0 +1,397 @@
+// Package journal implements an append-only on-disk journal of published
+// events that can be replayed, e.g. by plugins rebuilding their state.
+//
+// The journal is stored as a directory of segments; each segment is a file
+// of JSON lines named after the sequence number of its first entry. Only
+// the newest segment is written to. Older segments are deleted according
+// to the retention policy.
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/prologic/autodock/events"
+)
+
+const segmentExt = ".jsonl"
+
+// Entry is a single journaled event
+type Entry struct {
+	Seq     uint64          `json:"seq"`
+	Topic   string          `json:"topic"`
+	Payload json.RawMessage `json:"payload"`
+	Created time.Time       `json:"created"`
+}
+
+// Options configures a Journal
+type Options struct {
+	// SegmentSize is the size in bytes after which a new segment is started
+	SegmentSize int64
+
+	// MaxAge is how long segments are kept after they were last written
+	MaxAge time.Duration
+
+	// MaxSize is the total size in bytes of segments kept
+	MaxSize int64
+}
+
+// Query selects entries to replay
+type Query struct {
+	// Seq replays entries with a sequence number of at least Seq
+	Seq uint64
+
+	// Since replays entries created at or after Since
+	Since time.Time
+
+	// Topic replays only entries published to Topic, any of its children
+	// or, if a pattern, any topic it matches if not empty
+	Topic string
+
+	// Limit is the maximum number of entries to replay if not zero
+	Limit int
+}
+
+func (q Query) matches(e *Entry) bool {
+	if e.Seq < q.Seq {
+		return false
+	}
+	if !q.Since.IsZero() && e.Created.Before(q.Since) {
+		return false
+	}
+	if q.Topic != "" && !events.MatchTopicOrParent(q.Topic, e.Topic) {
+		return false
+	}
+	return true
+}
+
+// Journal ...
+type Journal struct {
+	sync.RWMutex
+
+	dir  string
+	opts Options
+
+	seq      uint64
+	segments []uint64
+	file     *os.File
+	size     int64
+}
+
+// Open opens (creating if necessary) the journal in dir
+func Open(dir string, opts Options) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating journal: %s", err)
+	}
+
+	j := &Journal{dir: dir, opts: opts}
+
+	segments, err := j.listSegments()
+	if err != nil {
+		return nil, err
+	}
+	j.segments = segments
+
+	if len(segments) == 0 {
+		if err := j.rotate(1); err != nil {
+			return nil, err
+		}
+		return j, nil
+	}
+
+	// recover the last sequence number from the newest segment
+	last := segments[len(segments)-1]
+	if err := j.truncatePartial(last); err != nil {
+		return nil, err
+	}
+
+	j.seq = last - 1
+	err = j.scan(last, func(e *Entry) error {
+		j.seq = e.Seq
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(j.segmentPath(last), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening journal segment: %s", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("error opening journal segment: %s", err)
+	}
+	j.file, j.size = f, fi.Size()
+
+	j.enforceRetention()
+
+	return j, nil
+}
+
+// Seq returns the sequence number of the newest entry
+func (j *Journal) Seq() uint64 {
+	j.RLock()
+	defer j.RUnlock()
+
+	return j.seq
+}
+
+// Publish appends an event to the journal. It implements
+// collector.Publisher so the journal can be published to like any other
+// sink.
+func (j *Journal) Publish(topic string, payload []byte) error {
+	if !json.Valid(payload) {
+		return fmt.Errorf("error journaling event: payload is not valid JSON")
+	}
+
+	j.Lock()
+	defer j.Unlock()
+
+	if j.file == nil {
+		return fmt.Errorf("error journaling event: journal closed")
+	}
+
+	if j.opts.SegmentSize > 0 && j.size >= j.opts.SegmentSize {
+		if err := j.rotate(j.seq + 1); err != nil {
+			return err
+		}
+		j.enforceRetention()
+	}
+
+	entry := &Entry{
+		Seq:     j.seq + 1,
+		Topic:   topic,
+		Payload: payload,
+		Created: time.Now(),
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error encoding journal entry: %s", err)
+	}
+	data = append(data, '\n')
+
+	n, err := j.file.Write(data)
+	j.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("error writing journal entry: %s", err)
+	}
+
+	j.seq = entry.Seq
+
+	return nil
+}
+
+// Replay calls fn for each entry matching q in order. Replay stops at the
+// first error returned by fn.
+func (j *Journal) Replay(q Query, fn func(e *Entry) error) error {
+	j.RLock()
+	segments := make([]uint64, len(j.segments))
+	copy(segments, j.segments)
+	j.RUnlock()
+
+	// skip segments that end before the requested sequence number
+	start := 0
+	for i := range segments {
+		if segments[i] <= q.Seq {
+			start = i
+		}
+	}
+
+	n := 0
+	errStop := fmt.Errorf("stop")
+
+	for _, segment := range segments[start:] {
+		err := j.scan(segment, func(e *Entry) error {
+			if !q.matches(e) {
+				return nil
+			}
+			if err := fn(e); err != nil {
+				return err
+			}
+			n++
+			if q.Limit > 0 && n >= q.Limit {
+				return errStop
+			}
+			return nil
+		})
+		if err == errStop {
+			return nil
+		}
+		if os.IsNotExist(err) {
+			// removed by retention while replaying
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close ...
+func (j *Journal) Close() error {
+	j.Lock()
+	defer j.Unlock()
+
+	if j.file == nil {
+		return nil
+	}
+
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+func (j *Journal) segmentPath(first uint64) string {
+	return filepath.Join(j.dir, fmt.Sprintf("%020d%s", first, segmentExt))
+}
+
+func (j *Journal) listSegments() ([]uint64, error) {
+	files, err := ioutil.ReadDir(j.dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading journal: %s", err)
+	}
+
+	var segments []uint64
+	for _, fi := range files {
+		name := fi.Name()
+		if !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		first, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, first)
+	}
+
+	sort.Slice(segments, func(a, b int) bool { return segments[a] < segments[b] })
+
+	return segments, nil
+}
+
+// scan calls fn for each entry of a segment. A partially written last
+// line, as left by a crash or a concurrent write, is ignored.
+func (j *Journal) scan(segment uint64, fn func(e *Entry) error) error {
+	f, err := os.Open(j.segmentPath(segment))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var e Entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			log.Warnf("skipping corrupt journal entry in segment %d: %s", segment, err)
+			continue
+		}
+		if err := fn(&e); err != nil {
+			return err
+		}
+	}
+}
+
+// truncatePartial removes a partially written last line from a segment so
+// that appending to it does not corrupt the next entry
+func (j *Journal) truncatePartial(segment uint64) error {
+	data, err := ioutil.ReadFile(j.segmentPath(segment))
+	if err != nil {
+		return fmt.Errorf("error reading journal segment: %s", err)
+	}
+
+	if len(data) == 0 || data[len(data)-1] == '\n' {
+		return nil
+	}
+
+	log.Warnf("truncating partially written entry in journal segment %d", segment)
+
+	size := bytes.LastIndexByte(data, '\n') + 1
+	if err := os.Truncate(j.segmentPath(segment), int64(size)); err != nil {
+		return fmt.Errorf("error truncating journal segment: %s", err)
+	}
+
+	return nil
+}
+
+// rotate starts a new segment whose first entry is first
+func (j *Journal) rotate(first uint64) error {
+	f, err := os.OpenFile(j.segmentPath(first), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("error creating journal segment: %s", err)
+	}
+
+	if j.file != nil {
+		j.file.Close()
+	}
+
+	j.file, j.size = f, 0
+	if len(j.segments) == 0 || j.segments[len(j.segments)-1] != first {
+		j.segments = append(j.segments, first)
+	}
+
+	return nil
+}
+
+// enforceRetention removes the oldest segments that are older than MaxAge
+// or exceed MaxSize. The segment being written to is never removed.
+func (j *Journal) enforceRetention() {
+	var (
+		total int64
+		sizes = make([]int64, len(j.segments))
+		times = make([]time.Time, len(j.segments))
+	)
+
+	for i, segment := range j.segments {
+		fi, err := os.Stat(j.segmentPath(segment))
+		if err != nil {
+			continue
+		}
+		sizes[i], times[i] = fi.Size(), fi.ModTime()
+		total += fi.Size()
+	}
+
+	remove := 0
+	for i := 0; i < len(j.segments)-1; i++ {
+		expired := j.opts.MaxAge > 0 && time.Since(times[i]) > j.opts.MaxAge
+		oversize := j.opts.MaxSize > 0 && total > j.opts.MaxSize
+		if !expired && !oversize {
+			break
+		}
+
+		if err := os.Remove(j.segmentPath(j.segments[i])); err != nil && !os.IsNotExist(err) {
+			log.Errorf("error removing journal segment: %s", err)
+			break
+		}
+		total -= sizes[i]
+		remove++
+	}
+
+	j.segments = j.segments[remove:]
+}
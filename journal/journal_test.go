@@ -0,0 +1,153 @@
+package journal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func replay(t *testing.T, j *Journal, q Query) []*Entry {
+	var entries []*Entry
+	if err := j.Replay(q, func(e *Entry) error {
+		entries = append(entries, e)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestJournalReplay(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	j, err := Open(dir, Options{SegmentSize: 256})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 20; i++ {
+		topic := "container.start.web"
+		if i%2 == 0 {
+			topic = "network"
+		}
+		if err := j.Publish(topic, []byte(fmt.Sprintf(`{"n":%d}`, i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(j.segments) < 2 {
+		t.Fatalf("expected journal to be rotated; got %d segments", len(j.segments))
+	}
+
+	entries := replay(t, j, Query{Seq: 15})
+	if len(entries) != 6 || entries[0].Seq != 15 || entries[5].Seq != 20 {
+		t.Fatalf("unexpected entries replayed from seq 15: %v", entries)
+	}
+
+	entries = replay(t, j, Query{Topic: "network", Limit: 3})
+	if len(entries) != 3 || entries[0].Seq != 2 || string(entries[2].Payload) != `{"n":6}` {
+		t.Fatalf("unexpected entries replayed for topic: %v", entries)
+	}
+
+	entries = replay(t, j, Query{Topic: "container", Limit: 2})
+	if len(entries) != 2 || entries[0].Seq != 1 || entries[1].Seq != 3 {
+		t.Fatalf("unexpected entries replayed for parent topic: %v", entries)
+	}
+
+	entries = replay(t, j, Query{Topic: "*.start", Limit: 1})
+	if len(entries) != 1 || entries[0].Topic != "container.start.web" {
+		t.Fatalf("unexpected entries replayed for topic pattern: %v", entries)
+	}
+
+	if err := j.Publish("container", []byte("not json")); err == nil {
+		t.Fatal("expected error journaling invalid JSON")
+	}
+
+	j.Close()
+
+	// reopening recovers the sequence number
+	j, err = Open(dir, Options{SegmentSize: 256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	if j.Seq() != 20 {
+		t.Fatalf("expected seq 20 after reopening; got %d", j.Seq())
+	}
+	if err := j.Publish("container", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	if entries := replay(t, j, Query{Seq: 21}); len(entries) != 1 {
+		t.Fatalf("expected new entry with seq 21; got %v", entries)
+	}
+}
+
+func TestJournalRetention(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	j, err := Open(dir, Options{SegmentSize: 100, MaxSize: 300})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	for i := 0; i < 50; i++ {
+		if err := j.Publish("container", []byte(`{}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries := replay(t, j, Query{})
+	if len(entries) == 0 || entries[0].Seq == 1 {
+		t.Fatal("expected oldest entries to be removed")
+	}
+	if last := entries[len(entries)-1]; last.Seq != 50 {
+		t.Fatalf("expected newest entry to be kept; got seq %d", last.Seq)
+	}
+}
+
+func TestJournalTruncatesPartialEntry(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	j, err := Open(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Publish("container", []byte(`{}`))
+	j.Close()
+
+	// simulate a crash part way through writing an entry
+	f, err := os.OpenFile(filepath.Join(dir, fmt.Sprintf("%020d%s", 1, segmentExt)), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte(`{"seq":2,"topic":"conta`))
+	f.Close()
+
+	j, err = Open(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	j.Publish("network", []byte(`{}`))
+
+	entries := replay(t, j, Query{})
+	if len(entries) != 2 || entries[1].Seq != 2 || entries[1].Topic != "network" {
+		t.Fatalf("unexpected entries after recovery: %v", entries)
+	}
+}
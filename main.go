@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	log "github.com/sirupsen/logrus"
 
@@ -14,6 +18,8 @@ import (
 )
 
 var (
+	configfile string
+
 	dockerurl string
 	msgbusurl string
 
@@ -23,16 +29,18 @@ var (
 	tlskey    string
 	tls       bool
 
-	debug   bool
-	version bool
+	debug       bool
+	version     bool
+	watchconfig bool
 
 	bind string
 )
 
 func init() {
-	flag.StringP("config", "c", "", "path to config file")
+	flag.StringVarP(&configfile, "config", "c", os.Getenv("AUTODOCK_CONFIG"), "path to config file (YAML, TOML or JSON)")
 	flag.BoolVarP(&debug, "debug", "d", false, "enable debug logging")
 	flag.BoolVarP(&version, "version", "v", false, "display version information")
+	flag.BoolVarP(&watchconfig, "watch-config", "w", false, "reload config file when it changes")
 
 	flag.StringVarP(&bind, "bind", "b", "0.0.0.0:8000", "[int]:<port> to bind to for HTTP")
 
@@ -54,43 +62,158 @@ func main() {
 		os.Exit(0)
 	}
 
-	if debug {
-		log.SetLevel(log.DebugLevel)
+	cfg, err := config.Load(configfile)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	cfg := &config.Config{
-		Debug: debug,
+	applyFlags(cfg)
 
-		Bind: bind,
-
-		DockerURL:     dockerurl,
-		MsgBusURL:     msgbusurl,
-		TLSCACert:     tlscacert,
-		TLSCert:       tlscert,
-		TLSKey:        tlskey,
-		AllowInsecure: !tlsverify,
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("invalid configuration: %s", err)
 	}
 
+	log.SetLevel(cfg.Level())
+
 	srv, err := server.NewServer(cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	err = srv.EnableCollector()
-	if err != nil {
-		log.Fatalf("error enabling collector: %s", err)
+	if cfg.Journal.Enabled {
+		err = srv.EnableJournal()
+		if err != nil {
+			log.Fatalf("error enabling journal: %s", err)
+		}
 	}
 
-	if cfg.MsgBusURL == "" {
+	if cfg.Collector.Enabled {
+		err = srv.EnableCollector()
+		if err != nil {
+			log.Fatalf("error enabling collector: %s", err)
+		}
+	}
+
+	if cfg.Hooks.Enabled() {
+		err = srv.EnableHooks()
+		if err != nil {
+			log.Fatalf("error enabling hooks: %s", err)
+		}
+	}
+
+	if cfg.LocalMessageBus() {
 		srv.EnableMessageBus()
 	}
 
-	err = srv.EnableProxy()
-	if err != nil {
-		log.Fatalf("error enabling proxy: %s", err)
+	if cfg.Proxy.Enabled {
+		err = srv.EnableProxy()
+		if err != nil {
+			log.Fatalf("error enabling proxy: %s", err)
+		}
 	}
 
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go func() {
+		for range sighup {
+			log.Info("received SIGHUP; reloading configuration")
+			reloadConfig(srv)
+		}
+	}()
+
+	if cfg.WatchConfig && configfile != "" {
+		go config.Watch(configfile, config.DefaultWatchInterval, nil, func() {
+			reloadConfig(srv)
+		})
+	}
+
+	stopped := make(chan struct{})
+
+	sigterm := make(chan os.Signal, 1)
+	signal.Notify(sigterm, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-sigterm
+		log.Infof("received %s; shutting down", sig)
+
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout.Duration)
+		defer cancel()
+
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Errorf("error shutting down: %s", err)
+		}
+		close(stopped)
+	}()
+
 	if err := srv.Run(); err != nil {
 		log.Fatal(err)
 	}
+
+	<-stopped
+}
+
+// applyFlags overrides the configuration with any flags explicitly set on
+// the command-line, which take precedence over the config file and env.
+func applyFlags(cfg *config.Config) {
+	changed := flag.CommandLine.Changed
+
+	if changed("debug") {
+		cfg.Debug = debug
+	}
+	if changed("watch-config") {
+		cfg.WatchConfig = watchconfig
+	}
+	if changed("bind") {
+		cfg.Bind = bind
+	}
+	if changed("docker-url") {
+		cfg.DockerURL = dockerurl
+	}
+	if changed("msgbus-url") {
+		cfg.MsgBusURL = msgbusurl
+	}
+	if changed("tls-ca-cert") {
+		cfg.TLSCACert = tlscacert
+	}
+	if changed("tls-cert") {
+		cfg.TLSCert = tlscert
+	}
+	if changed("tls-key") {
+		cfg.TLSKey = tlskey
+	}
+	if changed("tls-verify") {
+		cfg.AllowInsecure = !tlsverify
+	}
+}
+
+// reloadConfig re-reads the configuration and applies it to the running
+// server, reporting which changes were applied and which need a restart.
+func reloadConfig(srv *server.Server) {
+	cfg, err := config.Load(configfile)
+	if err != nil {
+		log.Errorf("error reloading configuration: %s", err)
+		return
+	}
+
+	applyFlags(cfg)
+
+	if err := cfg.Validate(); err != nil {
+		log.Errorf("invalid configuration; not reloading: %s", err)
+		return
+	}
+
+	applied, restart, err := srv.Reload(cfg)
+	if err != nil {
+		log.Errorf("error reloading configuration: %s", err)
+		return
+	}
+
+	if len(applied) > 0 {
+		log.Infof("configuration reloaded; applied: %s", strings.Join(applied, ", "))
+	} else {
+		log.Info("configuration reloaded; nothing to apply")
+	}
+
+	if len(restart) > 0 {
+		log.Warnf("configuration changes require a restart: %s", strings.Join(restart, ", "))
+	}
 }
@@ -1,7 +1,11 @@
 package metrics
 
 import (
+	"strconv"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
 )
 
 var (
@@ -22,19 +26,246 @@ var (
 			Help:      "Uptime in seconds",
 		},
 	)
+
+	eventsReceived = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "autodock",
+			Subsystem: "collector",
+			Name:      "events_received",
+			Help:      "Total number of events received from Docker by type and action",
+		},
+		[]string{"type", "action"},
+	)
+
+	lastEvent = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "autodock",
+			Subsystem: "collector",
+			Name:      "last_event_timestamp_seconds",
+			Help:      "Time of the last event received from Docker",
+		},
+	)
+
+	reconnects = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "autodock",
+			Subsystem: "collector",
+			Name:      "reconnects",
+			Help:      "Total number of times the collector reconnected to the Docker event stream after it failed",
+		},
+	)
+
+	publishDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "autodock",
+			Subsystem: "publisher",
+			Name:      "publish_duration_seconds",
+			Help:      "Time taken to publish an event by publisher",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"publisher"},
+	)
+
+	publishErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "autodock",
+			Subsystem: "publisher",
+			Name:      "errors",
+			Help:      "Total number of events that failed to be published by publisher",
+		},
+		[]string{"publisher"},
+	)
+
+	publishDropped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "autodock",
+			Subsystem: "publisher",
+			Name:      "events_dropped",
+			Help:      "Total number of events dropped because the buffer of publisher was full",
+		},
+		[]string{"publisher"},
+	)
+
+	proxyRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "autodock",
+			Subsystem: "proxy",
+			Name:      "requests",
+			Help:      "Total number of requests proxied to Docker by route, method, status and plugin",
+		},
+		[]string{"route", "method", "status", "plugin"},
+	)
+
+	proxyDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "autodock",
+			Subsystem: "proxy",
+			Name:      "request_duration_seconds",
+			Help:      "Time taken by requests proxied to Docker by route, method and plugin",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"route", "method", "plugin"},
+	)
+
+	proxyInFlight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "autodock",
+			Subsystem: "proxy",
+			Name:      "requests_in_flight",
+			Help:      "Number of requests to Docker being proxied, including streams, by route, method and plugin",
+		},
+		[]string{"route", "method", "plugin"},
+	)
+
+	lastPublished = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "autodock",
+			Subsystem: "publisher",
+			Name:      "last_published_timestamp_seconds",
+			Help:      "Time an event was last published successfully by publisher",
+		},
+		[]string{"publisher"},
+	)
 )
 
 type Metrics struct {
 	EventsProcessed prometheus.Counter
 	Uptime          prometheus.Counter
+
+	EventsReceived  *prometheus.CounterVec
+	LastEvent       prometheus.Gauge
+	Reconnects      prometheus.Counter
+	PublishDuration *prometheus.HistogramVec
+	PublishErrors   *prometheus.CounterVec
+	PublishDropped  *prometheus.CounterVec
+	LastPublished   *prometheus.GaugeVec
+
+	ProxyRequests *prometheus.CounterVec
+	ProxyDuration *prometheus.HistogramVec
+	ProxyInFlight *prometheus.GaugeVec
 }
 
 func NewMetrics() *Metrics {
 	prometheus.MustRegister(eventsProcessed)
 	prometheus.MustRegister(uptime)
+	prometheus.MustRegister(eventsReceived)
+	prometheus.MustRegister(lastEvent)
+	prometheus.MustRegister(reconnects)
+	prometheus.MustRegister(publishDuration)
+	prometheus.MustRegister(publishErrors)
+	prometheus.MustRegister(publishDropped)
+	prometheus.MustRegister(lastPublished)
+	prometheus.MustRegister(proxyRequests)
+	prometheus.MustRegister(proxyDuration)
+	prometheus.MustRegister(proxyInFlight)
 
 	return &Metrics{
 		EventsProcessed: eventsProcessed,
 		Uptime:          uptime,
+
+		EventsReceived:  eventsReceived,
+		LastEvent:       lastEvent,
+		Reconnects:      reconnects,
+		PublishDuration: publishDuration,
+		PublishErrors:   publishErrors,
+		PublishDropped:  publishDropped,
+		LastPublished:   lastPublished,
+
+		ProxyRequests: proxyRequests,
+		ProxyDuration: proxyDuration,
+		ProxyInFlight: proxyInFlight,
+	}
+}
+
+// EventReceived counts an event received from Docker and records its time
+func (m *Metrics) EventReceived(typ, action string, t time.Time) {
+	m.EventsReceived.WithLabelValues(typ, action).Inc()
+	m.LastEvent.Set(float64(t.UnixNano()) / float64(time.Second))
+}
+
+// EventProcessed counts an event that passed through the collector's
+// pipeline
+func (m *Metrics) EventProcessed() {
+	m.EventsProcessed.Inc()
+}
+
+// EventPublished records how long publisher took to publish an event and
+// counts failures
+func (m *Metrics) EventPublished(publisher string, d time.Duration, err error) {
+	m.PublishDuration.WithLabelValues(publisher).Observe(d.Seconds())
+	if err != nil {
+		m.PublishErrors.WithLabelValues(publisher).Inc()
+		return
+	}
+	m.LastPublished.WithLabelValues(publisher).SetToCurrentTime()
+}
+
+// EventDropped counts an event dropped because publisher's buffer was full
+func (m *Metrics) EventDropped(publisher string) {
+	m.PublishDropped.WithLabelValues(publisher).Inc()
+}
+
+// Reconnected counts a reconnect to the Docker event stream
+func (m *Metrics) Reconnected() {
+	m.Reconnects.Inc()
+}
+
+// RequestStarted counts a request being proxied to Docker as in flight
+func (m *Metrics) RequestStarted(route, method, plugin string) {
+	m.ProxyInFlight.WithLabelValues(route, method, plugin).Inc()
+}
+
+// RequestFinished counts a request proxied to Docker and records how long
+// it took
+func (m *Metrics) RequestFinished(route, method, plugin string, status int, d time.Duration) {
+	m.ProxyInFlight.WithLabelValues(route, method, plugin).Dec()
+	m.ProxyDuration.WithLabelValues(route, method, plugin).Observe(d.Seconds())
+	m.ProxyRequests.WithLabelValues(route, method, strconv.Itoa(status), plugin).Inc()
+}
+
+// Queue is a bounded queue of events waiting to be published
+type Queue interface {
+	QueueLen() int
+	QueueCap() int
+	Dropped() uint64
+}
+
+// WatchQueue exports the depth, capacity and number of events dropped of
+// the collector's queue of events waiting to be published
+func (m *Metrics) WatchQueue(q Queue) {
+	collectors := []prometheus.Collector{
+		prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Namespace: "autodock",
+				Subsystem: "collector",
+				Name:      "queue_depth",
+				Help:      "Number of events waiting to be published",
+			},
+			func() float64 { return float64(q.QueueLen()) },
+		),
+		prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Namespace: "autodock",
+				Subsystem: "collector",
+				Name:      "queue_capacity",
+				Help:      "Number of events that can wait to be published",
+			},
+			func() float64 { return float64(q.QueueCap()) },
+		),
+		prometheus.NewCounterFunc(
+			prometheus.CounterOpts{
+				Namespace: "autodock",
+				Subsystem: "collector",
+				Name:      "events_dropped",
+				Help:      "Total number of events dropped because the queue was full",
+			},
+			func() float64 { return float64(q.Dropped()) },
+		),
+	}
+
+	for _, c := range collectors {
+		if err := prometheus.Register(c); err != nil {
+			log.Warnf("error registering metric: %s", err)
+		}
 	}
 }
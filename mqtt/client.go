@@ -0,0 +1,114 @@
+// Package mqtt connects to MQTT brokers with the Eclipse Paho client and
+// maps between autodock topics and MQTT topics.
+package mqtt
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	// DefaultTimeout is how long to wait for the broker by default
+	DefaultTimeout = time.Second * 10
+
+	defaultKeepAlive = time.Second * 30
+)
+
+// Options configures a Client
+type Options struct {
+	ClientID string
+	Username string
+	Password string
+
+	// KeepAlive is the interval at which the connection is checked
+	KeepAlive time.Duration
+
+	// Timeout is how long to wait for the broker to acknowledge packets
+	Timeout time.Duration
+
+	// OnConnect is called each time the client is connected, e.g. to
+	// subscribe again after reconnecting
+	OnConnect func(c paho.Client)
+}
+
+// Client is a connection to an MQTT broker
+type Client = paho.Client
+
+// Message is a message received from a broker
+type Message = paho.Message
+
+// Handler is called with each message received on a subscription
+type Handler = paho.MessageHandler
+
+// NewClient returns a client of the broker at rawurl, e.g.
+// tcp://localhost:1883 or tls://broker:8883. Once connected the client
+// reconnects whenever the connection is lost. Handlers are called in their
+// own goroutine so that slow handlers don't hold up the connection.
+func NewClient(rawurl string, opts Options) (Client, error) {
+	broker, err := brokerURL(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.KeepAlive == 0 {
+		opts.KeepAlive = defaultKeepAlive
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultTimeout
+	}
+
+	o := paho.NewClientOptions()
+	o.AddBroker(broker)
+	o.SetClientID(opts.ClientID)
+	o.SetUsername(opts.Username)
+	o.SetPassword(opts.Password)
+	o.SetKeepAlive(opts.KeepAlive)
+	o.SetPingTimeout(opts.Timeout)
+	o.SetConnectTimeout(opts.Timeout)
+	o.SetWriteTimeout(opts.Timeout)
+	o.SetMaxReconnectInterval(time.Minute)
+	o.SetAutoReconnect(true)
+	o.SetOrderMatters(false)
+	if opts.OnConnect != nil {
+		o.SetOnConnectHandler(paho.OnConnectHandler(opts.OnConnect))
+	}
+
+	return paho.NewClient(o), nil
+}
+
+// Wait waits up to timeout for the operation of t to complete and returns
+// its error
+func Wait(t paho.Token, timeout time.Duration) error {
+	if !t.WaitTimeout(timeout) {
+		return fmt.Errorf("timeout waiting for broker")
+	}
+	return t.Error()
+}
+
+// brokerURL maps rawurl to a URL the Paho client accepts, with the scheme's
+// default port if none is given
+func brokerURL(rawurl string) (string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", fmt.Errorf("error parsing broker url: %s", err)
+	}
+
+	var port string
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		u.Scheme, port = "tcp", "1883"
+	case "tls", "ssl", "mqtts":
+		u.Scheme, port = "ssl", "8883"
+	default:
+		return "", fmt.Errorf("unsupported broker url scheme %q", u.Scheme)
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	return u.String(), nil
+}
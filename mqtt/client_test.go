@@ -0,0 +1,99 @@
+package mqtt_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prologic/autodock/mqtt"
+	"github.com/prologic/autodock/mqtt/mqtttest"
+)
+
+func TestClient(t *testing.T) {
+	broker := mqtttest.NewServer()
+	defer broker.Close()
+
+	var connects int32
+	countConnects := func(mqtt.Client) { atomic.AddInt32(&connects, 1) }
+
+	publisher, err := mqtt.NewClient(broker.URL, mqtt.Options{ClientID: "publisher", OnConnect: countConnects})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mqtt.Wait(publisher.Connect(), time.Second*5); err != nil {
+		t.Fatal(err)
+	}
+	defer publisher.Disconnect(0)
+
+	received := make(chan mqtt.Message, 10)
+	blocked := make(chan struct{})
+	defer close(blocked)
+
+	subscribe := func(c mqtt.Client) {
+		countConnects(c)
+		c.Subscribe(mqtt.Filter("autodock", "container.die"), 1, func(c mqtt.Client, m mqtt.Message) {
+			received <- m
+		})
+		// a handler that blocks must not hold up the others
+		c.Subscribe(mqtt.Filter("autodock", "container.kill"), 1, func(c mqtt.Client, m mqtt.Message) {
+			<-blocked
+		})
+	}
+	subscriber, err := mqtt.NewClient(broker.URL, mqtt.Options{ClientID: "subscriber", OnConnect: subscribe})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// retained before subscribing
+	if err := mqtt.Wait(publisher.Publish("autodock/container/die/web_1", 1, true, []byte("retained")), time.Second*5); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mqtt.Wait(subscriber.Connect(), time.Second*5); err != nil {
+		t.Fatal(err)
+	}
+	defer subscriber.Disconnect(0)
+
+	expect := func(expected string) {
+		t.Helper()
+		select {
+		case m := <-received:
+			if string(m.Payload()) != expected {
+				t.Errorf("expected %q got %q on %s", expected, m.Payload(), m.Topic())
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatalf("timed out waiting for %q", expected)
+		}
+	}
+	expect("retained")
+
+	for _, topic := range []string{"autodock/container/kill/web_2", "autodock/container/start/web_1", "autodock/container/die/web_2"} {
+		if err := mqtt.Wait(publisher.Publish(topic, 0, false, []byte("live")), time.Second*5); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect("live")
+
+	// clear the retained message so that it isn't received again
+	if err := mqtt.Wait(publisher.Publish("autodock/container/die/web_1", 1, true, []byte{}), time.Second*5); err != nil {
+		t.Fatal(err)
+	}
+	expect("")
+
+	// subscribes again after reconnecting; the message is retained as the
+	// subscriber may subscribe after it is published
+	broker.CloseClientConnections()
+	for deadline := time.Now().Add(time.Second * 10); atomic.LoadInt32(&connects) < 4; time.Sleep(time.Millisecond * 10) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for clients to reconnect")
+		}
+	}
+	if err := mqtt.Wait(publisher.Publish("autodock/container/die/web_3", 1, true, []byte("reconnected")), time.Second*5); err != nil {
+		t.Fatal(err)
+	}
+	expect("reconnected")
+
+	if _, err := mqtt.NewClient("http://broker", mqtt.Options{}); err == nil {
+		t.Error("expected error creating client of unsupported url")
+	}
+}
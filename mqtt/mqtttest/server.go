@@ -0,0 +1,236 @@
+// Package mqtttest provides an in-process MQTT broker for testing
+// publishers and subscribers, in the spirit of net/http/httptest.
+package mqtttest
+
+import (
+	"bufio"
+	"net"
+	"sync"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+
+	"github.com/prologic/autodock/mqtt"
+)
+
+// Message is a message published to the broker
+type Message struct {
+	Topic   string
+	Payload []byte
+	QoS     byte
+	Retain  bool
+}
+
+type conn struct {
+	sync.Mutex
+	net.Conn
+
+	filters []string
+}
+
+func (c *conn) write(p packets.ControlPacket) error {
+	c.Lock()
+	defer c.Unlock()
+
+	return p.Write(c.Conn)
+}
+
+// publish sends m to the client with QoS 0
+func (c *conn) publish(m *Message, retained bool) error {
+	p := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+	p.TopicName = m.Topic
+	p.Payload = m.Payload
+	p.Retain = retained
+	return c.write(p)
+}
+
+// Server is a minimal MQTT broker listening on a local port. Messages are
+// delivered to subscribers with QoS 0; retained messages are delivered to
+// new subscriptions.
+type Server struct {
+	sync.Mutex
+
+	// URL is the URL of the broker, e.g. tcp://127.0.0.1:50001
+	URL string
+
+	listener net.Listener
+	conns    map[*conn]bool
+	connects int
+	retained map[string]*Message
+	messages []*Message
+}
+
+// NewServer starts a broker; it must be closed with Close
+func NewServer() *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("mqtttest: failed to listen: " + err.Error())
+	}
+
+	s := &Server{
+		URL:      "tcp://" + l.Addr().String(),
+		listener: l,
+		conns:    make(map[*conn]bool),
+		retained: make(map[string]*Message),
+	}
+	go s.serve()
+
+	return s
+}
+
+// Messages returns the messages published to the broker
+func (s *Server) Messages() []*Message {
+	s.Lock()
+	defer s.Unlock()
+
+	return append([]*Message(nil), s.messages...)
+}
+
+// Connects returns the number of times clients have connected
+func (s *Server) Connects() int {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.connects
+}
+
+// Retained returns the message retained on topic if any
+func (s *Server) Retained(topic string) *Message {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.retained[topic]
+}
+
+// CloseClientConnections disconnects every client, e.g. to test
+// reconnecting
+func (s *Server) CloseClientConnections() {
+	s.Lock()
+	defer s.Unlock()
+
+	for c := range s.conns {
+		c.Close()
+	}
+}
+
+// Close stops the broker and disconnects every client
+func (s *Server) Close() {
+	s.listener.Close()
+	s.CloseClientConnections()
+}
+
+func (s *Server) serve() {
+	for {
+		nc, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		c := &conn{Conn: nc}
+		s.Lock()
+		s.conns[c] = true
+		s.Unlock()
+
+		go s.handle(c)
+	}
+}
+
+func (s *Server) handle(c *conn) {
+	defer func() {
+		c.Close()
+		s.Lock()
+		delete(s.conns, c)
+		s.Unlock()
+	}()
+
+	r := bufio.NewReader(c)
+	for {
+		p, err := packets.ReadPacket(r)
+		if err != nil {
+			return
+		}
+
+		switch p := p.(type) {
+		case *packets.ConnectPacket:
+			s.Lock()
+			s.connects++
+			s.Unlock()
+			c.write(packets.NewControlPacket(packets.Connack))
+		case *packets.PublishPacket:
+			s.publish(&Message{Topic: p.TopicName, Payload: p.Payload, QoS: p.Qos, Retain: p.Retain})
+			if p.Qos == 1 {
+				ack := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				ack.MessageID = p.MessageID
+				c.write(ack)
+			}
+		case *packets.SubscribePacket:
+			s.subscribe(c, p)
+		case *packets.PingreqPacket:
+			c.write(packets.NewControlPacket(packets.Pingresp))
+		case *packets.DisconnectPacket:
+			return
+		}
+	}
+}
+
+func (s *Server) publish(m *Message) {
+	s.Lock()
+	s.messages = append(s.messages, m)
+	if m.Retain {
+		if len(m.Payload) == 0 {
+			delete(s.retained, m.Topic)
+		} else {
+			s.retained[m.Topic] = m
+		}
+	}
+
+	var subscribers []*conn
+	for c := range s.conns {
+		c.Lock()
+		for _, filter := range c.filters {
+			if mqtt.MatchFilter(filter, m.Topic) {
+				subscribers = append(subscribers, c)
+				break
+			}
+		}
+		c.Unlock()
+	}
+	s.Unlock()
+
+	for _, c := range subscribers {
+		c.publish(m, false)
+	}
+}
+
+func (s *Server) subscribe(c *conn, p *packets.SubscribePacket) {
+	// only QoS 0 and 1 are granted
+	ack := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+	ack.MessageID = p.MessageID
+	for _, qos := range p.Qoss {
+		if qos > 1 {
+			qos = 1
+		}
+		ack.ReturnCodes = append(ack.ReturnCodes, qos)
+	}
+
+	c.Lock()
+	c.filters = append(c.filters, p.Topics...)
+	c.Unlock()
+
+	c.write(ack)
+
+	s.Lock()
+	var retained []*Message
+	for topic, m := range s.retained {
+		for _, filter := range p.Topics {
+			if mqtt.MatchFilter(filter, topic) {
+				retained = append(retained, m)
+				break
+			}
+		}
+	}
+	s.Unlock()
+
+	for _, m := range retained {
+		c.publish(m, true)
+	}
+}
@@ -0,0 +1,76 @@
+package mqtt
+
+import (
+	"strings"
+
+	"github.com/prologic/autodock/events"
+)
+
+const (
+	// DefaultPrefix is the MQTT topic autodock topics are mapped under
+	DefaultPrefix = "autodock"
+
+	separator    = "/"
+	wildcard     = "+"
+	wildcardRest = "#"
+)
+
+// Topic maps an autodock topic to an MQTT topic under prefix, e.g.
+// container.die.web_1 to autodock/container/die/web_1. Separators in the
+// name level are replaced so that each level maps to a single MQTT level.
+func Topic(prefix, topic string) string {
+	levels := events.SplitTopic(topic)
+	for i := range levels {
+		levels[i] = strings.Replace(levels[i], separator, "_", -1)
+	}
+	return join(prefix, levels)
+}
+
+// Filter maps an autodock topic pattern to an MQTT topic filter receiving
+// the events the pattern matches, including events on child topics as
+// with events.MatchTopicOrParent, e.g. container.*.web_1 to
+// autodock/container/+/web_1/#
+func Filter(prefix, pattern string) string {
+	levels := events.SplitTopic(pattern)
+	for i, level := range levels {
+		switch level {
+		case events.TopicWildcard:
+			levels[i] = wildcard
+		case events.TopicWildcardRest:
+			levels[i] = wildcardRest
+		default:
+			levels[i] = strings.Replace(level, separator, "_", -1)
+		}
+	}
+	if levels[len(levels)-1] != wildcardRest {
+		levels = append(levels, wildcardRest)
+	}
+	return join(prefix, levels)
+}
+
+func join(prefix string, levels []string) string {
+	if prefix = strings.Trim(prefix, separator); prefix != "" {
+		levels = append([]string{prefix}, levels...)
+	}
+	return strings.Join(levels, separator)
+}
+
+// MatchFilter reports whether topic matches the MQTT topic filter
+func MatchFilter(filter, topic string) bool {
+	filters := strings.Split(filter, separator)
+	levels := strings.Split(topic, separator)
+
+	for i, f := range filters {
+		if f == wildcardRest {
+			return true
+		}
+		if i >= len(levels) {
+			return false
+		}
+		if f != wildcard && f != levels[i] {
+			return false
+		}
+	}
+
+	return len(filters) == len(levels)
+}
@@ -0,0 +1,61 @@
+package mqtt
+
+import (
+	"testing"
+)
+
+func TestTopic(t *testing.T) {
+	testCases := []struct {
+		prefix, topic, expected string
+	}{
+		{"autodock", "container.die.web_1", "autodock/container/die/web_1"},
+		{"autodock", "image.pull.registry.example.com/app:1.0", "autodock/image/pull/registry.example.com_app:1.0"},
+		{"/edge/host1/", "container", "edge/host1/container"},
+		{"", "service.update.web", "service/update/web"},
+	}
+
+	for _, testCase := range testCases {
+		if actual := Topic(testCase.prefix, testCase.topic); actual != testCase.expected {
+			t.Errorf("Topic(%q, %q): expected %q got %q", testCase.prefix, testCase.topic, testCase.expected, actual)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	testCases := []struct {
+		pattern, expected string
+	}{
+		{"container", "autodock/container/#"},
+		{"container.die", "autodock/container/die/#"},
+		{"container.*.web_1", "autodock/container/+/web_1/#"},
+		{"service.#", "autodock/service/#"},
+		{"*.create", "autodock/+/create/#"},
+	}
+
+	for _, testCase := range testCases {
+		if actual := Filter("autodock", testCase.pattern); actual != testCase.expected {
+			t.Errorf("Filter(%q): expected %q got %q", testCase.pattern, testCase.expected, actual)
+		}
+	}
+}
+
+func TestMatchFilter(t *testing.T) {
+	testCases := []struct {
+		filter, topic string
+		expected      bool
+	}{
+		{"a/b/c", "a/b/c", true},
+		{"a/+/c", "a/b/c", true},
+		{"a/+/c", "a/b/d", false},
+		{"a/#", "a", true},
+		{"a/#", "a/b/c", true},
+		{"a/b", "a/b/c", false},
+		{"a/b/c", "a/b", false},
+	}
+
+	for _, testCase := range testCases {
+		if actual := MatchFilter(testCase.filter, testCase.topic); actual != testCase.expected {
+			t.Errorf("MatchFilter(%q, %q): expected %t got %t", testCase.filter, testCase.topic, testCase.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package plugin
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jpillora/backoff"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/prologic/autodock/mqtt"
+)
+
+type mqttSubscription struct {
+	filter  string
+	handler mqtt.Handler
+}
+
+// mqttSubscriber receives events from an MQTT broker autodock publishes
+// to, reconnecting and resubscribing whenever the connection is lost.
+// Events are handled concurrently.
+type mqttSubscriber struct {
+	sync.Mutex
+
+	prefix string
+	client mqtt.Client
+	subs   []mqttSubscription
+}
+
+func newMQTTSubscriber(url, prefix, clientID string) (*mqttSubscriber, error) {
+	s := &mqttSubscriber{prefix: prefix}
+
+	client, err := mqtt.NewClient(url, mqtt.Options{ClientID: clientID, OnConnect: s.subscribeAll})
+	if err != nil {
+		return nil, err
+	}
+	s.client = client
+	go s.connect()
+
+	return s, nil
+}
+
+// Subscribe subscribes handler to events matching pattern. Events received
+// over MQTT have no id and are timestamped when received.
+func (s *mqttSubscriber) Subscribe(pattern string, handler HandlerFunc) {
+	sub := mqttSubscription{
+		filter: mqtt.Filter(s.prefix, pattern),
+		handler: func(c mqtt.Client, m mqtt.Message) {
+			if err := handler(0, m.Payload(), time.Now()); err != nil {
+				log.Errorf("error handling %s event: %s", pattern, err)
+			}
+		},
+	}
+
+	s.Lock()
+	s.subs = append(s.subs, sub)
+	s.Unlock()
+
+	if s.client.IsConnectionOpen() {
+		s.subscribe(s.client, sub)
+	}
+}
+
+// connect connects to the broker, retrying until connected; the client
+// then reconnects by itself
+func (s *mqttSubscriber) connect() {
+	b := &backoff.Backoff{Min: time.Second, Max: time.Minute, Jitter: true}
+
+	for {
+		err := mqtt.Wait(s.client.Connect(), mqtt.DefaultTimeout)
+		if err == nil {
+			return
+		}
+		d := b.Duration()
+		log.Errorf("error connecting to mqtt broker: %s; retrying in %s", err, d)
+		time.Sleep(d)
+	}
+}
+
+// subscribeAll subscribes to every subscription once connected
+func (s *mqttSubscriber) subscribeAll(c mqtt.Client) {
+	s.Lock()
+	subs := append([]mqttSubscription(nil), s.subs...)
+	s.Unlock()
+
+	for _, sub := range subs {
+		s.subscribe(c, sub)
+	}
+}
+
+func (s *mqttSubscriber) subscribe(c mqtt.Client, sub mqttSubscription) {
+	go func() {
+		if err := mqtt.Wait(c.Subscribe(sub.filter, 1, sub.handler), mqtt.DefaultTimeout); err != nil {
+			log.Errorf("error subscribing to %s: %s", sub.filter, err)
+		}
+	}()
+}
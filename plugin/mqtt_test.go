@@ -0,0 +1,47 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/prologic/autodock/collector"
+	"github.com/prologic/autodock/config"
+	"github.com/prologic/autodock/mqtt/mqtttest"
+)
+
+func TestMQTTSubscriber(t *testing.T) {
+	broker := mqtttest.NewServer()
+	defer broker.Close()
+
+	s, err := newMQTTSubscriber(broker.URL, "autodock", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.client.Disconnect(0)
+
+	h := &countingHandler{counts: make(map[string]int)}
+	s.Subscribe("container.die", h.handle)
+
+	p := collector.NewMQTTPublisher(broker.URL, config.MQTTConfig{QoS: 1, Retain: true})
+	defer p.Close()
+
+	if err := p.Publish("container.die.web_1", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Publish("container.start.web_1", []byte("ignored")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return h.total() == 1 })
+
+	// subscribes again after reconnecting; events are retained so that
+	// they are received even if published before subscribing again
+	connects := broker.Connects()
+	broker.CloseClientConnections()
+	waitFor(t, func() bool {
+		return broker.Connects() >= connects+2 && s.client.IsConnectionOpen() && p.Publish("container.die.web_2", []byte("2")) == nil
+	})
+	waitFor(t, func() bool {
+		h.Lock()
+		defer h.Unlock()
+		return h.counts["2"] > 0
+	})
+}
@@ -11,6 +11,11 @@ import (
 	msgbusclient "github.com/prologic/msgbus/client"
 	log "github.com/sirupsen/logrus"
 	flag "github.com/spf13/pflag"
+
+	"github.com/prologic/autodock/events"
+	"github.com/prologic/autodock/mqtt"
+	"github.com/prologic/autodock/proxy"
+	"github.com/prologic/autodock/redis"
 )
 
 const (
@@ -25,7 +30,7 @@ type HandlerFunc func(id uint64, payload []byte, created time.Time) error
 
 // Context ...
 type Context interface {
-	On(event string, handler HandlerFunc)
+	On(event string, handler HandlerFunc, options ...Option)
 	Docker() *dockerclient.Client
 }
 
@@ -33,22 +38,125 @@ type pluginContext struct {
 	host   string
 	port   int
 	msgbus *msgbusclient.Client
+	mqtt   *mqttSubscriber
+	redis  *redisSubscriber
 	docker *dockerclient.Client
-	topics map[string]*msgbusclient.Subscriber
+	topics map[string][]*msgbusclient.Subscriber
 }
 
-// On ...
-func (ctx *pluginContext) On(event string, handler HandlerFunc) {
-	subscriber := ctx.msgbus.Subscribe(
-		event,
-		func(msg *msgbus.Message) error {
-			return handler(msg.ID, msg.Payload, msg.Created)
-		},
+// On subscribes handler to events published on the topic event, e.g.
+// container, container.die or container.die.web_1. event may also be a
+// pattern with wildcards such as container.*.web_1 or *.create in which
+// case events are filtered by the plugin. If the plugin was started with
+// --mqtt or --redis events are received from the MQTT broker or Redis
+// stream instead.
+func (ctx *pluginContext) On(event string, handler HandlerFunc, options ...Option) {
+	opts := &subscribeOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	var (
+		last uint64
+		err  error
 	)
 
-	ctx.topics[event] = subscriber
+	if opts.replay {
+		last, err = ctx.replay(event, opts.seq, opts.since, handler)
+		if err != nil {
+			log.Errorf("error replaying %s events: %s", event, err)
+		}
+	}
+
+	switch {
+	case ctx.mqtt != nil:
+		ctx.mqtt.Subscribe(event, handler)
+	case ctx.redis != nil:
+		ctx.redis.Subscribe(event, handler)
+	default:
+		ctx.subscribe(event, handler)
+	}
+
+	if opts.replay && err == nil {
+		// catch up with events journaled while subscribing; these may also
+		// be received live so handlers should be idempotent
+		if _, err := ctx.replay(event, last+1, opts.since, handler); err != nil {
+			log.Errorf("error replaying %s events: %s", event, err)
+		}
+	}
+}
+
+// subscribe subscribes handler to events matching event on the message bus
+func (ctx *pluginContext) subscribe(event string, handler HandlerFunc) {
+	if err := checkPattern(event); err != nil {
+		log.Errorf("error subscribing to %s: %s", event, err)
+		return
+	}
+
+	for _, topic := range subscribeTopics(event) {
+		topic := topic
+		subscriber := ctx.msgbus.Subscribe(topic, func(msg *msgbus.Message) error {
+			if !exactTopic(event, topic) && !matchEvent(event, msg.Payload) {
+				return nil
+			}
+			return handler(msg.ID, msg.Payload, msg.Created)
+		})
+
+		ctx.topics[event] = append(ctx.topics[event], subscriber)
 
-	subscriber.Start()
+		subscriber.Start()
+	}
+}
+
+// subscribeTopics returns the topics to subscribe to on the message bus
+// to receive every event matching pattern
+func subscribeTopics(pattern string) []string {
+	if prefix := events.TopicPrefix(pattern); prefix != "" {
+		return []string{prefix}
+	}
+	return events.Types
+}
+
+// exactTopic reports whether every event published on topic matches
+// pattern so that events need not be decoded to be matched, e.g. for
+// webhooks whose payloads are not autodock events
+func exactTopic(pattern, topic string) bool {
+	return pattern == topic || pattern == topic+events.TopicSeparator+events.TopicWildcardRest
+}
+
+// checkPattern returns an error if the events matching pattern can't be
+// told apart on the message bus. Messages don't carry the topic they were
+// published on, so patterns with wildcards are matched against the topic
+// of the decoded event, which only events of events.Types have; payloads
+// published by generic webhook sources are not events.
+func checkPattern(pattern string) error {
+	prefix := events.TopicPrefix(pattern)
+	if prefix == "" || exactTopic(pattern, prefix) {
+		return nil
+	}
+
+	typ := events.SplitTopic(prefix)[0]
+	for _, t := range events.Types {
+		if t == typ {
+			return nil
+		}
+	}
+
+	return fmt.Errorf(
+		"wildcards only match Docker and autodock events on the message bus; "+
+			"subscribe to %s.# or run the plugin with --mqtt or --redis", prefix,
+	)
+}
+
+// matchEvent reports whether the event encoded in payload was published on
+// a topic matching pattern
+func matchEvent(pattern string, payload []byte) bool {
+	m, err := events.DecodeMessage(payload)
+	if err != nil {
+		log.Error(err)
+		return false
+	}
+	return events.MatchTopicOrParent(pattern, events.Topic(m))
 }
 
 // Docker ...
@@ -72,6 +180,14 @@ func (p *Plugin) init() error {
 		debug   bool
 		host    string
 		port    int
+
+		mqttURL    string
+		mqttPrefix string
+
+		redisURL      string
+		redisStream   string
+		redisGroup    string
+		redisConsumer string
 	)
 
 	flag.BoolVarP(&version, "version", "v", false, "display version information")
@@ -80,6 +196,14 @@ func (p *Plugin) init() error {
 	flag.StringVarP(&host, "host", "h", "localhost", "autodock host to connect to")
 	flag.IntVarP(&port, "port", "p", 8000, "autodock port to connect to")
 
+	flag.StringVar(&mqttURL, "mqtt", "", "receive events from the MQTT broker at this url, e.g. tcp://broker:1883")
+	flag.StringVar(&mqttPrefix, "mqtt-prefix", mqtt.DefaultPrefix, "MQTT topic prefix autodock publishes events under")
+
+	flag.StringVar(&redisURL, "redis", "", "consume events from a Redis stream at this url, e.g. redis://redis:6379")
+	flag.StringVar(&redisStream, "redis-stream", redis.DefaultStream, "Redis stream autodock adds events to")
+	flag.StringVar(&redisGroup, "redis-group", p.Name, "Redis consumer group shared by replicas of the plugin")
+	flag.StringVar(&redisConsumer, "redis-consumer", "", "Redis consumer name unique to this replica (default <hostname>-<pid>)")
+
 	flag.Parse()
 
 	if version {
@@ -104,6 +228,8 @@ func (p *Plugin) init() error {
 
 	defaultHeaders := map[string]string{
 		"User-Agent": fmt.Sprintf("autodock-%s", p.Version),
+		// identifies the plugin in the proxy's metrics
+		proxy.PluginHeader: p.Name,
 	}
 
 	docker, err := dockerclient.NewClient(
@@ -116,11 +242,30 @@ func (p *Plugin) init() error {
 		return err
 	}
 
-	p.ctx = &pluginContext{
+	ctx := &pluginContext{
+		host:   host,
+		port:   port,
 		msgbus: msgbus,
 		docker: docker,
-		topics: make(map[string]*msgbusclient.Subscriber),
+		topics: make(map[string][]*msgbusclient.Subscriber),
+	}
+	if mqttURL != "" {
+		clientID := fmt.Sprintf("%s-%d", p.Name, os.Getpid())
+		if ctx.mqtt, err = newMQTTSubscriber(mqttURL, mqttPrefix, clientID); err != nil {
+			return err
+		}
+	}
+	if redisURL != "" {
+		if redisConsumer == "" {
+			hostname, err := os.Hostname()
+			if err != nil {
+				hostname = "localhost"
+			}
+			redisConsumer = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+		}
+		ctx.redis = newRedisSubscriber(redisURL, redisStream, redisGroup, redisConsumer)
 	}
+	p.ctx = ctx
 
 	return nil
 }
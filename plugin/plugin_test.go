@@ -0,0 +1,36 @@
+package plugin
+
+import (
+	"testing"
+)
+
+func TestCheckPattern(t *testing.T) {
+	valid := []string{
+		"container",
+		"container.*.web_1",
+		"*.create",
+		"#",
+		"github.push.#",
+		"alertmanager",
+		"alertmanager.firing",
+		"alertmanager.#",
+		"hook.ci",
+	}
+	for _, pattern := range valid {
+		if err := checkPattern(pattern); err != nil {
+			t.Errorf("%s: unexpected error %s", pattern, err)
+		}
+	}
+
+	invalid := []string{
+		"alertmanager.*",
+		"hook.*",
+		"alertmanager.*.#",
+		"alertmanager.firing.*",
+	}
+	for _, pattern := range invalid {
+		if err := checkPattern(pattern); err == nil {
+			t.Errorf("%s: expected error", pattern)
+		}
+	}
+}
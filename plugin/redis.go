@@ -0,0 +1,241 @@
+package plugin
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jpillora/backoff"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/prologic/autodock/events"
+	"github.com/prologic/autodock/redis"
+)
+
+const (
+	redisBatchSize = 100
+	redisBlock     = time.Second * 5
+
+	// redisClaimIdle is how long an entry may be pending before another
+	// consumer claims it, e.g. because the replica it was delivered to
+	// died or its handler failed
+	redisClaimIdle = time.Minute
+
+	// redisMaxDeliveries is how many times an entry is delivered before
+	// it is given up on and acknowledged without being handled
+	redisMaxDeliveries = 5
+)
+
+type redisHandler struct {
+	pattern string
+	handler HandlerFunc
+}
+
+// redisSubscriber consumes events from a Redis stream as a consumer of a
+// consumer group, so that each event is handled by only one of the
+// replicas of a plugin sharing the group. Entries are acknowledged once
+// every matching handler succeeded; entries left pending by failed
+// handlers or dead replicas are claimed and handled again once idle for
+// redisClaimIdle, up to redisMaxDeliveries times. Consuming starts with the first subscription, so entries
+// matching no handler are left pending until claimed in case the handler
+// they are for is yet to be subscribed.
+type redisSubscriber struct {
+	sync.Mutex
+
+	url      string
+	stream   string
+	group    string
+	consumer string
+
+	// claimIdle is redisClaimIdle except in tests
+	claimIdle time.Duration
+
+	handlers []redisHandler
+	start    sync.Once
+	stop     chan struct{}
+}
+
+func newRedisSubscriber(url, stream, group, consumer string) *redisSubscriber {
+	return &redisSubscriber{
+		url:       url,
+		stream:    stream,
+		group:     group,
+		consumer:  consumer,
+		claimIdle: redisClaimIdle,
+		stop:      make(chan struct{}),
+	}
+}
+
+// Subscribe subscribes handler to events matching pattern. Events received
+// from Redis have no id and the time they were added to the stream.
+func (s *redisSubscriber) Subscribe(pattern string, handler HandlerFunc) {
+	s.Lock()
+	s.handlers = append(s.handlers, redisHandler{pattern, handler})
+	s.Unlock()
+
+	s.start.Do(func() { go s.run() })
+}
+
+// Close stops consuming events
+func (s *redisSubscriber) Close() {
+	close(s.stop)
+}
+
+func (s *redisSubscriber) stopped() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *redisSubscriber) run() {
+	b := &backoff.Backoff{Min: time.Second, Max: time.Minute, Jitter: true}
+
+	for !s.stopped() {
+		if err := s.consume(); err != nil {
+			d := b.Duration()
+			log.Errorf("error consuming events from redis: %s; retrying in %s", err, d)
+
+			select {
+			case <-time.After(d):
+			case <-s.stop:
+				return
+			}
+			continue
+		}
+		b.Reset()
+	}
+}
+
+// consume consumes events until the connection fails or the subscriber is
+// closed
+func (s *redisSubscriber) consume() error {
+	conn, err := redis.Dial(s.url, 0)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := redis.XGroupCreate(conn, s.stream, s.group); err != nil {
+		return err
+	}
+
+	// entries delivered to this consumer before it restarted
+	for id := "0"; ; {
+		entries, err := redis.XReadGroup(conn, s.group, s.consumer, s.stream, id, redisBatchSize, 0)
+		if err != nil {
+			return err
+		}
+		s.handle(conn, entries, false)
+		if len(entries) < redisBatchSize {
+			break
+		}
+		id = entries[len(entries)-1].ID
+	}
+
+	var claimed time.Time
+	for !s.stopped() {
+		if time.Since(claimed) >= s.claimIdle/2 {
+			if err := s.claim(conn); err != nil {
+				return err
+			}
+			claimed = time.Now()
+		}
+
+		entries, err := redis.XReadGroup(conn, s.group, s.consumer, s.stream, ">", redisBatchSize, redisBlock)
+		if err != nil {
+			return err
+		}
+		s.handle(conn, entries, false)
+	}
+
+	return nil
+}
+
+// claim claims and handles entries pending for longer than claimIdle.
+// Entries already delivered redisMaxDeliveries times are acknowledged
+// instead, so that an event its handlers keep failing on isn't retried
+// forever.
+func (s *redisSubscriber) claim(conn redis.Conn) error {
+	for start := "-"; ; {
+		pending, err := redis.XPending(conn, s.stream, s.group, start, redisBatchSize)
+		if err != nil {
+			return fmt.Errorf("error listing pending events: %s", err)
+		}
+
+		var ids []string
+		for _, p := range pending {
+			if p.Idle < s.claimIdle {
+				continue
+			}
+			if p.Deliveries >= redisMaxDeliveries {
+				log.Errorf("giving up on event %s after %d deliveries", p.ID, p.Deliveries)
+				if err := redis.XAck(conn, s.stream, s.group, p.ID); err != nil {
+					return fmt.Errorf("error acknowledging event %s: %s", p.ID, err)
+				}
+				continue
+			}
+			ids = append(ids, p.ID)
+		}
+
+		if len(ids) > 0 {
+			entries, err := redis.XClaim(conn, s.stream, s.group, s.consumer, s.claimIdle, ids...)
+			if err != nil {
+				return fmt.Errorf("error claiming pending events: %s", err)
+			}
+
+			// entries still matching no handler long after they were
+			// received are for events the plugin doesn't subscribe to
+			s.handle(conn, entries, true)
+		}
+
+		if len(pending) < redisBatchSize {
+			return nil
+		}
+		start = redis.NextID(pending[len(pending)-1].ID)
+	}
+}
+
+// handle passes entries to the matching handlers and acknowledges those
+// handled successfully and, if ackUnmatched, those matching no handler
+func (s *redisSubscriber) handle(conn redis.Conn, entries []redis.StreamEntry, ackUnmatched bool) {
+	s.Lock()
+	handlers := s.handlers
+	s.Unlock()
+
+	for _, entry := range entries {
+		if entry.Fields != nil {
+			matched, ok := s.dispatch(handlers, entry)
+			if !ok || (!matched && !ackUnmatched) {
+				continue
+			}
+		}
+
+		// entries whose fields are nil were deleted, e.g. by trimming, and
+		// can never be handled
+		if err := redis.XAck(conn, s.stream, s.group, entry.ID); err != nil {
+			log.Errorf("error acknowledging event %s: %s", entry.ID, err)
+		}
+	}
+}
+
+// dispatch calls the handlers matching the topic of entry and reports
+// whether any matched and whether all of them succeeded
+func (s *redisSubscriber) dispatch(handlers []redisHandler, entry redis.StreamEntry) (matched, ok bool) {
+	topic, payload := entry.Fields["topic"], []byte(entry.Fields["payload"])
+
+	ok = true
+	for _, h := range handlers {
+		if !events.MatchTopicOrParent(h.pattern, topic) {
+			continue
+		}
+		matched = true
+		if err := h.handler(0, payload, entry.Time()); err != nil {
+			log.Errorf("error handling event %s %s: %s", entry.ID, topic, err)
+			ok = false
+		}
+	}
+	return matched, ok
+}
@@ -0,0 +1,252 @@
+package plugin
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/prologic/autodock/collector"
+	"github.com/prologic/autodock/config"
+	"github.com/prologic/autodock/redis"
+)
+
+// newRedisServer starts an in-process Redis server; it must be closed with
+// Close
+func newRedisServer(t *testing.T) *miniredis.Miniredis {
+	m, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(time.Second * 10)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+type countingHandler struct {
+	sync.Mutex
+	counts map[string]int
+	fail   bool
+}
+
+func (h *countingHandler) handle(id uint64, payload []byte, created time.Time) error {
+	h.Lock()
+	defer h.Unlock()
+
+	if h.fail {
+		return fmt.Errorf("failed")
+	}
+	h.counts[string(payload)]++
+	return nil
+}
+
+func (h *countingHandler) total() int {
+	h.Lock()
+	defer h.Unlock()
+
+	n := 0
+	for _, count := range h.counts {
+		n += count
+	}
+	return n
+}
+
+func TestRedisConsumerGroup(t *testing.T) {
+	m := newRedisServer(t)
+	defer m.Close()
+	url := "redis://" + m.Addr()
+	stream := fmt.Sprintf("autodock-test-%d", time.Now().UnixNano())
+
+	a := &countingHandler{counts: make(map[string]int)}
+	b := &countingHandler{counts: make(map[string]int)}
+
+	replicaA := newRedisSubscriber(url, stream, "plugin", "a")
+	replicaA.Subscribe("container.die", a.handle)
+	defer replicaA.Close()
+
+	replicaB := newRedisSubscriber(url, stream, "plugin", "b")
+	replicaB.Subscribe("container.die", b.handle)
+	defer replicaB.Close()
+
+	// wait for the group to be created so that no event is missed
+	time.Sleep(time.Second)
+
+	p := collector.NewRedisPublisher(url, config.RedisConfig{Stream: stream})
+	defer p.Close()
+
+	for i := 0; i < 20; i++ {
+		p.Publish("container.die.web_1", []byte(fmt.Sprintf("%d", i)))
+		p.Publish("container.start.web_1", []byte("ignored"))
+	}
+
+	waitFor(t, func() bool { return a.total()+b.total() >= 20 })
+	time.Sleep(time.Millisecond * 100)
+
+	a.Lock()
+	defer a.Unlock()
+	b.Lock()
+	defer b.Unlock()
+
+	for i := 0; i < 20; i++ {
+		event := fmt.Sprintf("%d", i)
+		if n := a.counts[event] + b.counts[event]; n != 1 {
+			t.Errorf("expected event %s to be handled once got %d", event, n)
+		}
+	}
+}
+
+func TestRedisClaimsPending(t *testing.T) {
+	m := newRedisServer(t)
+	defer m.Close()
+	url := "redis://" + m.Addr()
+	stream := fmt.Sprintf("autodock-test-%d", time.Now().UnixNano())
+
+	failing := &countingHandler{counts: make(map[string]int), fail: true}
+	healthy := &countingHandler{counts: make(map[string]int)}
+
+	replicaA := newRedisSubscriber(url, stream, "plugin", "a")
+	replicaA.Subscribe("container", failing.handle)
+
+	time.Sleep(time.Second)
+
+	p := collector.NewRedisPublisher(url, config.RedisConfig{Stream: stream})
+	defer p.Close()
+	p.Publish("container.die.web_1", []byte("1"))
+
+	// give replica a time to receive and fail to handle the event
+	time.Sleep(time.Second)
+	replicaA.Close()
+
+	replicaB := newRedisSubscriber(url, stream, "plugin", "b")
+	replicaB.claimIdle = time.Millisecond * 500
+	replicaB.Subscribe("container", healthy.handle)
+	defer replicaB.Close()
+
+	waitFor(t, func() bool { return healthy.total() == 1 })
+}
+
+// pendingIDs returns the IDs of the entries of stream pending for group
+func pendingIDs(t *testing.T, conn redis.Conn, stream, group string) []string {
+	reply, err := conn.Do("XPENDING", stream, group, "-", "+", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the reply is nil if no entries are pending
+	values, _ := reply.([]interface{})
+
+	var ids []string
+	for _, p := range values {
+		ids = append(ids, string(p.([]interface{})[0].([]byte)))
+	}
+	return ids
+}
+
+func TestRedisLeavesUnmatchedPending(t *testing.T) {
+	m := newRedisServer(t)
+	defer m.Close()
+
+	conn, err := redis.Dial("redis://"+m.Addr(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := redis.XGroupCreate(conn, "autodock", "plugin"); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"1-0", "2-0", "3-0"} {
+		if _, err := conn.Do("XADD", "autodock", id, "topic", "container"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := redis.XReadGroup(conn, "plugin", "a", "autodock", ">", 10, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	h := &countingHandler{counts: make(map[string]int)}
+
+	s := newRedisSubscriber("", "autodock", "plugin", "a")
+	s.handlers = []redisHandler{{"container.die", h.handle}}
+
+	entries := []redis.StreamEntry{
+		{ID: "1-0", Fields: map[string]string{"topic": "container.die.web_1", "payload": "1"}},
+		{ID: "2-0", Fields: map[string]string{"topic": "container.start.web_1", "payload": "2"}},
+		{ID: "3-0"},
+	}
+
+	// the handler for container.start may yet be subscribed
+	s.handle(conn, entries, false)
+	if ids := pendingIDs(t, conn, "autodock", "plugin"); !reflect.DeepEqual(ids, []string{"2-0"}) {
+		t.Errorf("expected only 2-0 to be left pending got %v", ids)
+	}
+
+	// but not once the entry has been pending for claimIdle
+	s.handle(conn, entries[1:2], true)
+	if ids := pendingIDs(t, conn, "autodock", "plugin"); len(ids) != 0 {
+		t.Errorf("expected no entries to be left pending got %v", ids)
+	}
+
+	if h.total() != 1 {
+		t.Errorf("expected 1 event handled got %d", h.total())
+	}
+}
+
+func TestRedisGivesUpAfterMaxDeliveries(t *testing.T) {
+	m := newRedisServer(t)
+	defer m.Close()
+
+	conn, err := redis.Dial("redis://"+m.Addr(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := redis.XGroupCreate(conn, "autodock", "plugin"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := redis.XAdd(conn, "autodock", 0, "topic", "container.die.web_1", "payload", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := redis.XReadGroup(conn, "plugin", "a", "autodock", ">", 10, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var attempts int
+	s := newRedisSubscriber("", "autodock", "plugin", "b")
+	s.claimIdle = 0
+	s.handlers = []redisHandler{{"container", func(id uint64, payload []byte, created time.Time) error {
+		attempts++
+		return fmt.Errorf("failed")
+	}}}
+
+	for i := 0; i < redisMaxDeliveries; i++ {
+		if err := s.claim(conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// delivered once to a and then to b until given up on
+	if attempts != redisMaxDeliveries-1 {
+		t.Errorf("expected %d attempts got %d", redisMaxDeliveries-1, attempts)
+	}
+	if ids := pendingIDs(t, conn, "autodock", "plugin"); len(ids) != 0 {
+		t.Errorf("expected no entries to be left pending got %v", ids)
+	}
+
+	s.group = "missing"
+	if err := s.claim(conn); err == nil {
+		t.Error("expected error claiming events of missing group")
+	}
+}
@@ -0,0 +1,91 @@
+package plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/prologic/autodock/journal"
+)
+
+// Option configures a subscription made with Context.On
+type Option func(*subscribeOptions)
+
+type subscribeOptions struct {
+	replay bool
+	seq    uint64
+	since  time.Time
+}
+
+// ReplayFrom replays events journaled by autodock with a sequence number of
+// at least seq before receiving new events. The sequence number is passed
+// to the handler as the event id. autodock must have the journal enabled.
+func ReplayFrom(seq uint64) Option {
+	return func(opts *subscribeOptions) {
+		opts.replay = true
+		opts.seq = seq
+	}
+}
+
+// ReplaySince replays events journaled by autodock since t before
+// receiving new events. autodock must have the journal enabled.
+func ReplaySince(t time.Time) Option {
+	return func(opts *subscribeOptions) {
+		opts.replay = true
+		opts.since = t
+	}
+}
+
+// replay calls handler for each journaled event on topic and returns the
+// sequence number of the last event replayed
+func (ctx *pluginContext) replay(topic string, seq uint64, since time.Time, handler HandlerFunc) (uint64, error) {
+	query := url.Values{}
+	query.Set("topic", topic)
+	query.Set("seq", strconv.FormatUint(seq, 10))
+	if !since.IsZero() {
+		query.Set("since", since.Format(time.RFC3339Nano))
+	}
+
+	u := fmt.Sprintf("http://%s:%d/journal?%s", ctx.host, ctx.port, query.Encode())
+
+	res, err := http.Get(u)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected response from journal: %s", res.Status)
+	}
+
+	last := seq
+	if seq > 0 {
+		last = seq - 1
+	}
+
+	r := bufio.NewReader(res.Body)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			return last, nil
+		}
+		if err != nil {
+			return last, err
+		}
+
+		var e journal.Entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return last, fmt.Errorf("error decoding journal entry: %s", err)
+		}
+
+		if err := handler(e.Seq, e.Payload, e.Created); err != nil {
+			return last, err
+		}
+		last = e.Seq
+	}
+}
@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// PluginHeader is the header plugins identify themselves with in requests
+// to the proxy
+const PluginHeader = "X-Autodock-Plugin"
+
+// maxPluginLength is the length plugin names are truncated to
+const maxPluginLength = 64
+
+// plugin matches the names plugins may identify themselves with
+var plugin = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// Method returns method if it is a standard HTTP method or Other
+func Method(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return Other
+}
+
+// Plugin returns the name a plugin identified itself with, truncated to
+// maxPluginLength, or Other if it contains characters other than
+// letters, digits, '_', '.' and '-'.
+func Plugin(name string) string {
+	if name == "" {
+		return ""
+	}
+	if !plugin.MatchString(name) {
+		return Other
+	}
+	if len(name) > maxPluginLength {
+		name = name[:maxPluginLength]
+	}
+	return name
+}
+
+// Observer is told about each proxied request, e.g. to export metrics.
+// route is the Docker API endpoint requested (see Route) and plugin the
+// name of the plugin making the request, if known. Its methods may be
+// called concurrently.
+type Observer interface {
+	// RequestStarted is called when a request is received
+	RequestStarted(route, method, plugin string)
+
+	// RequestFinished is called once the response has been written, which
+	// for streams such as /events is when the stream ends
+	RequestFinished(route, method, plugin string, status int, d time.Duration)
+}
+
+type nopObserver struct{}
+
+func (nopObserver) RequestStarted(route, method, plugin string)                               {}
+func (nopObserver) RequestFinished(route, method, plugin string, status int, d time.Duration) {}
+
+// statusRecorder records the status code of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	wrote  bool
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	// informational responses such as 103 Early Hints precede the status
+	if !w.wrote && status >= 200 {
+		w.status = status
+		w.wrote = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	w.wrote = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush flushes streamed responses such as /events to the client
+func (w *statusRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hands the connection over for upgraded responses such as
+// /containers/{id}/attach; the proxy writes the 101 Switching Protocols
+// response to the connection itself, so it is recorded here
+func (w *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("error hijacking connection: not supported by %T", w.ResponseWriter)
+	}
+	conn, rw, err := h.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !w.wrote {
+		w.status = http.StatusSwitchingProtocols
+		w.wrote = true
+	}
+	return conn, rw, nil
+}
+
+// Unwrap allows http.ResponseController to reach the underlying
+// ResponseWriter, e.g. to set deadlines
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -8,14 +8,20 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
 // Proxy ...
 type Proxy struct {
-	target *url.URL
-	proxy  *httputil.ReverseProxy
+	sync.RWMutex
+
+	target   *url.URL
+	proxy    *httputil.ReverseProxy
+	rules    *Rules
+	observer Observer
 }
 
 // NewProxy ...
@@ -48,12 +54,47 @@ func NewProxy(dockerURL string, tlsconfig *tls.Config) (*Proxy, error) {
 		return nil, fmt.Errorf("unsupported scheme: %s", u.Scheme)
 	}
 
-	return &Proxy{target: u, proxy: p}, nil
+	return &Proxy{target: u, proxy: p, rules: &Rules{}, observer: nopObserver{}}, nil
+}
+
+// SetRules replaces the access rules applied to proxied requests
+func (p *Proxy) SetRules(rules *Rules) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.rules = rules
+}
+
+// Observe sets the observer told about each proxied request
+func (p *Proxy) Observe(observer Observer) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.observer = observer
 }
 
 // Handler ...
 func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	p.proxy.ServeHTTP(w, r)
+	p.RLock()
+	rules, observer := p.rules, p.observer
+	p.RUnlock()
+
+	route, method, plugin := Route(r.URL.Path), Method(r.Method), Plugin(r.Header.Get(PluginHeader))
+
+	observer.RequestStarted(route, method, plugin)
+	started := time.Now()
+	rw := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	defer func() {
+		observer.RequestFinished(route, method, plugin, rw.status, time.Since(started))
+	}()
+
+	if !rules.Allowed(r.Method, r.URL.Path) {
+		log.Warnf("proxy request denied: %s %s", r.Method, r.URL.Path)
+		http.Error(rw, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	p.proxy.ServeHTTP(rw, r)
 }
 
 // UNIXTransport ...
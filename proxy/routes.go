@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Other is the route, method or plugin of requests whose path isn't a
+// Docker API endpoint, method isn't standard or plugin name is malformed,
+// so that callers can't create arbitrarily many metrics
+const Other = "other"
+
+// resource describes a collection of the Docker API such as /containers
+type resource struct {
+	// fixed are the paths below the collection that are not objects, e.g.
+	// json in /containers/json
+	fixed []string
+
+	// slashes is true if object names may contain slashes, as image and
+	// plugin names do, in which case only the last segment of a path may
+	// be an action, e.g. /images/library/nginx:latest/json
+	slashes bool
+}
+
+var resources = map[string]resource{
+	"containers":   {fixed: []string{"json", "create", "prune"}},
+	"images":       {fixed: []string{"json", "create", "load", "get", "search", "prune"}, slashes: true},
+	"networks":     {fixed: []string{"create", "prune"}},
+	"volumes":      {fixed: []string{"create", "prune"}},
+	"exec":         {},
+	"swarm":        {fixed: []string{"init", "join", "leave", "update", "unlockkey", "unlock"}},
+	"nodes":        {},
+	"services":     {fixed: []string{"create"}},
+	"tasks":        {},
+	"secrets":      {fixed: []string{"create"}},
+	"configs":      {fixed: []string{"create"}},
+	"plugins":      {fixed: []string{"privileges", "pull", "create"}, slashes: true},
+	"distribution": {slashes: true},
+	"build":        {fixed: []string{"prune", "cancel"}},
+	"system":       {fixed: []string{"df"}},
+}
+
+// endpoints are the Docker API endpoints outside any collection
+var endpoints = map[string]bool{
+	"_ping":   true,
+	"version": true,
+	"info":    true,
+	"events":  true,
+	"auth":    true,
+	"commit":  true,
+	"session": true,
+}
+
+// action matches the actions on objects, e.g. start in
+// /containers/{id}/start
+var action = regexp.MustCompile(`^[a-z]+$`)
+
+// Route returns the route of the Docker API endpoint a proxied request is
+// for, with object ids and names replaced by {id} or {name}, e.g.
+// "v1.39/containers/4fa6e0f0c678/start" -> "/containers/{id}/start", or
+// Other if the path isn't a Docker API endpoint
+func Route(p string) string {
+	p = strings.Trim(NormalizePath(p), "/")
+	if p == "" {
+		return Other
+	}
+	segments := strings.Split(p, "/")
+
+	r, ok := resources[segments[0]]
+	if !ok {
+		if len(segments) == 1 && endpoints[segments[0]] {
+			return "/" + segments[0]
+		}
+		return Other
+	}
+
+	route := "/" + segments[0]
+	if len(segments) == 1 {
+		return route
+	}
+
+	for _, fixed := range r.fixed {
+		if segments[1] == fixed {
+			if len(segments) > 2 {
+				return Other
+			}
+			return route + "/" + fixed
+		}
+	}
+
+	if r.slashes {
+		route += "/{name}"
+		if last := segments[len(segments)-1]; len(segments) > 2 && isNameAction(last) {
+			route += "/" + last
+		}
+		return route
+	}
+
+	// e.g. /containers/{id}/attach/ws
+	if len(segments) > 4 {
+		return Other
+	}
+
+	route += "/{id}"
+	for _, s := range segments[2:] {
+		if !action.MatchString(s) {
+			return Other
+		}
+		route += "/" + s
+	}
+	return route
+}
+
+// isNameAction reports whether the last segment of the path of an object
+// whose name may contain slashes is an action rather than part of its name
+func isNameAction(s string) bool {
+	switch s {
+	case "json", "history", "push", "tag", "get",
+		"enable", "disable", "upgrade", "set":
+		return true
+	}
+	return false
+}
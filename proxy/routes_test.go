@@ -0,0 +1,219 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRoute(t *testing.T) {
+	tests := []struct {
+		path  string
+		route string
+	}{
+		{"v1.39/_ping", "/_ping"},
+		{"/v1.39/events", "/events"},
+		{"info", "/info"},
+		{"v1.39/containers/json", "/containers/json"},
+		{"v1.39/containers/4fa6e0f0c678/start", "/containers/{id}/start"},
+		{"v1.39/containers/web_1/attach/ws", "/containers/{id}/attach/ws"},
+		{"v1.39/containers/4fa6e0f0c678", "/containers/{id}"},
+		{"v1.39/images/nginx/json", "/images/{name}/json"},
+		{"v1.39/images/registry:5000/library/nginx:latest/json", "/images/{name}/json"},
+		{"v1.39/images/library/nginx:latest", "/images/{name}"},
+		{"v1.39/images/create", "/images/create"},
+		{"v1.39/networks/abc/connect", "/networks/{id}/connect"},
+		{"v1.39/services/app/update", "/services/{id}/update"},
+		{"v1.39/plugins/vieux/sshfs:latest/enable", "/plugins/{name}/enable"},
+		{"v1.39/system/df", "/system/df"},
+		{"", Other},
+		{"v1.39/secret", Other},
+		{"v1.39/containers/json/extra", Other},
+		{"v1.39/containers/abc/Start", Other},
+		{"v1.39/containers/abc/a/b/c", Other},
+	}
+
+	for _, test := range tests {
+		if route := Route(test.path); route != test.route {
+			t.Errorf("%q: expected route %q got %q", test.path, test.route, route)
+		}
+	}
+}
+
+func TestLabels(t *testing.T) {
+	methods := map[string]string{
+		"GET":      "GET",
+		"DELETE":   "DELETE",
+		"get":      Other,
+		"PROPFIND": Other,
+		"":         Other,
+	}
+	for method, expected := range methods {
+		if m := Method(method); m != expected {
+			t.Errorf("%q: expected method %q got %q", method, expected, m)
+		}
+	}
+
+	plugins := map[string]string{
+		"":                       "",
+		"restarter":              "restarter",
+		"my-plugin_2.0":          "my-plugin_2.0",
+		"evil\nplugin":           Other,
+		"a b":                    Other,
+		strings.Repeat("x", 100): strings.Repeat("x", maxPluginLength),
+	}
+	for name, expected := range plugins {
+		if p := Plugin(name); p != expected {
+			t.Errorf("%q: expected plugin %q got %q", name, expected, p)
+		}
+	}
+}
+
+// recordingObserver records the requests it is told about
+type recordingObserver struct {
+	sync.Mutex
+	inFlight int
+	finished []string
+}
+
+func (o *recordingObserver) RequestStarted(route, method, plugin string) {
+	o.Lock()
+	defer o.Unlock()
+	o.inFlight++
+}
+
+func (o *recordingObserver) RequestFinished(route, method, plugin string, status int, d time.Duration) {
+	o.Lock()
+	defer o.Unlock()
+	o.inFlight--
+	o.finished = append(o.finished, strings.Join([]string{method, route, plugin, http.StatusText(status)}, " "))
+}
+
+func TestProxyObserver(t *testing.T) {
+	docker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1.39/containers/abc/json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("OK"))
+	}))
+	defer docker.Close()
+
+	p, err := NewProxy("tcp://"+strings.TrimPrefix(docker.URL, "http://"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := NewRules(nil, []string{"POST /containers/*/kill"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetRules(rules)
+
+	observer := &recordingObserver{}
+	p.Observe(observer)
+
+	requests := []struct {
+		method, path, plugin string
+	}{
+		{"GET", "/v1.39/_ping", ""},
+		{"GET", "/v1.39/containers/abc/json", "restarter"},
+		{"POST", "/v1.39/containers/abc/kill", "restarter"},
+		{"BREW", "/v1.39/_ping", "<script>"},
+	}
+	for _, r := range requests {
+		req := httptest.NewRequest(r.method, r.path, nil)
+		if r.plugin != "" {
+			req.Header.Set(PluginHeader, r.plugin)
+		}
+		p.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	expected := []string{
+		"GET /_ping  OK",
+		"GET /containers/{id}/json restarter Not Found",
+		"POST /containers/{id}/kill restarter Forbidden",
+		"other /_ping other OK",
+	}
+	if observer.inFlight != 0 {
+		t.Errorf("expected no requests in flight got %d", observer.inFlight)
+	}
+	for i, e := range expected {
+		if i >= len(observer.finished) || observer.finished[i] != e {
+			t.Errorf("expected requests %q got %q", expected, observer.finished)
+			break
+		}
+	}
+}
+
+func TestProxyObserverUpgrade(t *testing.T) {
+	docker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 UPGRADED\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+		rw.WriteString("attached")
+		rw.Flush()
+	}))
+	defer docker.Close()
+
+	p, err := NewProxy("tcp://"+strings.TrimPrefix(docker.URL, "http://"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	observer := &recordingObserver{}
+	p.Observe(observer)
+
+	server := httptest.NewServer(p)
+	defer server.Close()
+
+	req, err := http.NewRequest("POST", server.URL+"/v1.39/containers/abc/attach?stream=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+	req.Header.Set(PluginHeader, "logs")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expected status %d got %d", http.StatusSwitchingProtocols, res.StatusCode)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "attached" {
+		t.Errorf("expected %q got %q", "attached", body)
+	}
+
+	// the request finishes once the proxy has closed both connections
+	for deadline := time.Now().Add(time.Second * 5); ; time.Sleep(time.Millisecond * 10) {
+		observer.Lock()
+		n := len(observer.finished)
+		observer.Unlock()
+		if n > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for request to finish")
+		}
+	}
+
+	expected := []string{"POST /containers/{id}/attach logs Switching Protocols"}
+	observer.Lock()
+	defer observer.Unlock()
+	if len(observer.finished) != 1 || observer.finished[0] != expected[0] {
+		t.Errorf("expected requests %q got %q", expected, observer.finished)
+	}
+}
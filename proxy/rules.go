@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/prologic/autodock/config"
+)
+
+var versionPrefix = regexp.MustCompile(`^/v[0-9]+(\.[0-9]+)*(/|$)`)
+
+// Rule ...
+type Rule struct {
+	Method  string
+	Pattern string
+}
+
+// Matches returns true if the rule applies to the method and path
+func (r Rule) Matches(method, p string) bool {
+	if r.Method != "" && r.Method != method {
+		return false
+	}
+	ok, _ := path.Match(r.Pattern, p)
+	return ok
+}
+
+// Rules controls which Docker API calls may be made through the proxy
+type Rules struct {
+	Allow []Rule
+	Deny  []Rule
+}
+
+// NewRules parses allow and deny rules as described by config.ProxyConfig
+func NewRules(allow, deny []string) (*Rules, error) {
+	rules := &Rules{}
+
+	for _, s := range allow {
+		method, pattern, err := config.ParseAccessRule(s)
+		if err != nil {
+			return nil, err
+		}
+		rules.Allow = append(rules.Allow, Rule{method, pattern})
+	}
+
+	for _, s := range deny {
+		method, pattern, err := config.ParseAccessRule(s)
+		if err != nil {
+			return nil, err
+		}
+		rules.Deny = append(rules.Deny, Rule{method, pattern})
+	}
+
+	return rules, nil
+}
+
+// Allowed returns true if the request may be proxied
+func (r *Rules) Allowed(method, p string) bool {
+	p = NormalizePath(p)
+
+	for _, rule := range r.Deny {
+		if rule.Matches(method, p) {
+			return false
+		}
+	}
+
+	if len(r.Allow) == 0 {
+		return true
+	}
+
+	for _, rule := range r.Allow {
+		if rule.Matches(method, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NormalizePath returns the Docker API path of a proxied request without
+// its API version prefix, e.g. "v1.39/containers/json" -> "/containers/json"
+func NormalizePath(p string) string {
+	return versionPrefix.ReplaceAllString("/"+strings.TrimLeft(p, "/"), "/")
+}
@@ -0,0 +1,59 @@
+// Package recent implements a bounded set remembering the most recently
+// added keys, e.g. to discard events or notifications delivered more than
+// once.
+package recent
+
+import (
+	"sync"
+)
+
+// Set is a bounded set that remembers the most recently added keys. It is
+// safe for concurrent use.
+type Set struct {
+	sync.Mutex
+
+	// keys maps each key to its slot in order
+	keys  map[string]int
+	order []string
+	next  int
+}
+
+// NewSet returns a Set remembering up to size keys
+func NewSet(size int) *Set {
+	return &Set{
+		keys:  make(map[string]int, size),
+		order: make([]string, size),
+	}
+}
+
+// Add adds key to the set, evicting the oldest key if the set is full, and
+// returns false if key was already present.
+func (s *Set) Add(key string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.keys[key]; ok {
+		return false
+	}
+
+	if old := s.order[s.next]; old != "" {
+		delete(s.keys, old)
+	}
+	s.order[s.next] = key
+	s.keys[key] = s.next
+	s.next = (s.next + 1) % len(s.order)
+
+	return true
+}
+
+// Remove removes key from the set, e.g. if handling it failed and it may
+// be added again
+func (s *Set) Remove(key string) {
+	s.Lock()
+	defer s.Unlock()
+
+	if i, ok := s.keys[key]; ok {
+		s.order[i] = ""
+		delete(s.keys, key)
+	}
+}
@@ -0,0 +1,35 @@
+package recent
+
+import (
+	"testing"
+)
+
+func TestSet(t *testing.T) {
+	s := NewSet(3)
+
+	for _, key := range []string{"a", "b"} {
+		if !s.Add(key) {
+			t.Fatalf("expected %s to be added", key)
+		}
+	}
+	if s.Add("a") {
+		t.Error("expected a to be present")
+	}
+
+	// a is added again after being removed, into a new slot
+	s.Remove("a")
+	if !s.Add("a") {
+		t.Fatal("expected removed a to be added again")
+	}
+
+	// evicts the oldest key, b, and not the slot a was removed from
+	if !s.Add("c") || !s.Add("d") {
+		t.Fatal("expected c and d to be added")
+	}
+	if s.Add("a") {
+		t.Error("expected a to be present")
+	}
+	if !s.Add("b") {
+		t.Error("expected b to have been evicted")
+	}
+}
@@ -0,0 +1,42 @@
+// Package redis connects to Redis servers with the Redigo client and
+// implements the Redis Streams commands autodock uses to publish events
+// and consume them with consumer groups.
+package redis
+
+import (
+	"fmt"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+const defaultTimeout = time.Second * 10
+
+// Conn is a connection to a Redis server. Once it fails Err returns a
+// non-nil error and it must be redialed.
+type Conn = redigo.Conn
+
+// Error is an error reply from the server, e.g. "BUSYGROUP Consumer Group
+// name already exists"
+type Error = redigo.Error
+
+// Dial connects to the server at rawurl of the form
+// redis://[[user]:password@]host[:port][/db] or rediss:// for TLS. Commands
+// time out after timeout, or a default if zero.
+func Dial(rawurl string, timeout time.Duration) (Conn, error) {
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+
+	conn, err := redigo.DialURL(
+		rawurl,
+		redigo.DialConnectTimeout(timeout),
+		redigo.DialReadTimeout(timeout),
+		redigo.DialWriteTimeout(timeout),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to redis: %s", err)
+	}
+
+	return conn, nil
+}
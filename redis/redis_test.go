@@ -0,0 +1,151 @@
+package redis
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestDial(t *testing.T) {
+	m, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	conn, err := Dial("redis://"+m.Addr()+"/1", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := XAdd(conn, "autodock", 0, "topic", "container.die.web_1"); err != nil {
+		t.Fatal(err)
+	}
+	m.Select(1)
+	if !m.Exists("autodock") {
+		t.Error("expected database to be selected")
+	}
+
+	if _, err := Dial("http://"+m.Addr(), time.Second); err == nil {
+		t.Error("expected error dialing unsupported url")
+	}
+}
+
+func TestStreams(t *testing.T) {
+	m, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	conn, err := Dial("redis://"+m.Addr(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for i := 0; i < 2; i++ {
+		if err := XGroupCreate(conn, "autodock", "plugin"); err != nil {
+			t.Errorf("expected existing group to be ignored got %s", err)
+		}
+	}
+
+	for _, payload := range []string{"1", "2"} {
+		if _, err := XAdd(conn, "autodock", 1000, "topic", "container.die.web_1", "payload", []byte(payload)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := XReadGroup(conn, "plugin", "replica-1", "autodock", ">", 10, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries got %d", len(entries))
+	}
+	fields := map[string]string{"topic": "container.die.web_1", "payload": "1"}
+	if !reflect.DeepEqual(entries[0].Fields, fields) {
+		t.Errorf("expected fields %v got %v", fields, entries[0].Fields)
+	}
+	if d := time.Since(entries[0].Time()); d < 0 || d > time.Minute {
+		t.Errorf("unexpected entry time %s", entries[0].Time())
+	}
+
+	// timed out waiting for entries
+	entries, err = XReadGroup(conn, "plugin", "replica-1", "autodock", ">", 10, time.Millisecond)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("expected no entries got %v %v", entries, err)
+	}
+
+	delivered, err := XReadGroup(conn, "plugin", "replica-1", "autodock", "0", 10, 0)
+	if err != nil || len(delivered) != 2 {
+		t.Fatalf("expected 2 pending entries got %v %v", delivered, err)
+	}
+	if err := XAck(conn, "autodock", "plugin", delivered[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := XPending(conn, "autodock", "plugin", "-", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].Consumer != "replica-1" || pending[0].Deliveries != 2 {
+		t.Fatalf("expected 1 entry pending for replica-1 delivered twice got %+v", pending)
+	}
+	if after, err := XPending(conn, "autodock", "plugin", NextID(pending[0].ID), 10); err != nil || len(after) != 0 {
+		t.Errorf("expected no entries pending after %s got %v %v", pending[0].ID, after, err)
+	}
+
+	entries, err = XClaim(conn, "autodock", "plugin", "replica-2", 0, pending[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].ID != pending[0].ID || entries[0].Fields["payload"] != "2" {
+		t.Errorf("expected %s to be claimed got %v", pending[0].ID, entries)
+	}
+	if pending, err := XPending(conn, "autodock", "plugin", "-", 10); err != nil || len(pending) != 1 || pending[0].Consumer != "replica-2" {
+		t.Errorf("expected entry to be pending for replica-2 got %+v %v", pending, err)
+	}
+}
+
+func TestNextID(t *testing.T) {
+	tests := map[string]string{
+		"1700000000000-0": "1700000000000-1",
+		"1700000000000-9": "1700000000000-10",
+		"invalid":         "invalid",
+	}
+	for id, expected := range tests {
+		if next := NextID(id); next != expected {
+			t.Errorf("expected %q to be followed by %q got %q", id, expected, next)
+		}
+	}
+}
+
+func TestParseEntries(t *testing.T) {
+	reply := []interface{}{
+		[]interface{}{[]byte("1700000000000-0"), []interface{}{[]byte("topic"), []byte("container.die.web_1")}},
+		// deleted, e.g. by trimming the stream
+		[]interface{}{[]byte("1700000000001-0"), nil},
+		// deleted, as replied by XCLAIM
+		nil,
+	}
+
+	entries, err := parseEntries(reply, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []StreamEntry{
+		{ID: "1700000000000-0", Fields: map[string]string{"topic": "container.die.web_1"}},
+		{ID: "1700000000001-0"},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %v got %v", expected, entries)
+	}
+	if entries[0].Time() != time.Unix(1700000000, 0) {
+		t.Errorf("unexpected entry time %s", entries[0].Time())
+	}
+}
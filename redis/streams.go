@@ -0,0 +1,201 @@
+package redis
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+// DefaultStream is the stream autodock adds events to by default
+const DefaultStream = "autodock"
+
+// StreamEntry is an entry of a stream
+type StreamEntry struct {
+	ID     string
+	Fields map[string]string
+}
+
+// Time returns the time the entry was added, from the milliseconds part of
+// its ID
+func (e StreamEntry) Time() time.Time {
+	ms, err := strconv.ParseInt(strings.SplitN(e.ID, "-", 2)[0], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
+
+// XAdd adds an entry to stream, trimming it to approximately maxLen
+// entries if maxLen is not zero, and returns the ID of the entry
+func XAdd(c Conn, stream string, maxLen int64, fields ...interface{}) (string, error) {
+	args := redigo.Args{stream}
+	if maxLen > 0 {
+		args = args.Add("MAXLEN", "~", maxLen)
+	}
+	args = args.Add("*").Add(fields...)
+
+	return redigo.String(c.Do("XADD", args...))
+}
+
+// XGroupCreate creates a consumer group reading new entries of stream,
+// creating the stream if necessary. It is not an error if the group
+// exists.
+func XGroupCreate(c Conn, stream, group string) error {
+	_, err := c.Do("XGROUP", "CREATE", stream, group, "$", "MKSTREAM")
+	if e, ok := err.(Error); ok && strings.HasPrefix(string(e), "BUSYGROUP") {
+		return nil
+	}
+	return err
+}
+
+// XReadGroup reads up to count entries of stream for consumer of group
+// after id, which is ">" for entries never delivered to the group or e.g.
+// "0" for the consumer's pending entries, waiting up to block for new
+// entries if block is not zero
+func XReadGroup(c Conn, group, consumer, stream, id string, count int, block time.Duration) ([]StreamEntry, error) {
+	args := redigo.Args{"GROUP", group, consumer, "COUNT", count}
+	if block > 0 {
+		args = args.Add("BLOCK", int64(block/time.Millisecond))
+	}
+	args = args.Add("STREAMS", stream, id)
+
+	streams, err := redigo.Values(redigo.DoWithTimeout(c, defaultTimeout+block, "XREADGROUP", args...))
+	if err == redigo.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(streams) == 0 {
+		return nil, fmt.Errorf("unexpected reply to XREADGROUP")
+	}
+
+	s, err := redigo.Values(streams[0], nil)
+	if err != nil || len(s) != 2 {
+		return nil, fmt.Errorf("unexpected reply to XREADGROUP")
+	}
+
+	return parseEntries(s[1], nil)
+}
+
+// XAck acknowledges entries handled by a consumer of group
+func XAck(c Conn, stream, group string, ids ...string) error {
+	_, err := c.Do("XACK", redigo.Args{stream, group}.AddFlat(ids)...)
+	return err
+}
+
+// PendingEntry is an entry delivered to a consumer of a group but not yet
+// acknowledged
+type PendingEntry struct {
+	ID       string
+	Consumer string
+
+	// Idle is how long ago the entry was last delivered
+	Idle time.Duration
+
+	// Deliveries is how many times the entry was delivered
+	Deliveries int64
+}
+
+// XPending returns up to count entries of stream pending for consumers of
+// group, starting at the entry with ID start or "-" for the first
+func XPending(c Conn, stream, group, start string, count int) ([]PendingEntry, error) {
+	values, err := redigo.Values(c.Do("XPENDING", stream, group, start, "+", count))
+	if err == redigo.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make([]PendingEntry, 0, len(values))
+	for _, v := range values {
+		e, err := redigo.Values(v, nil)
+		if err != nil || len(e) != 4 {
+			return nil, fmt.Errorf("unexpected reply to XPENDING")
+		}
+
+		var (
+			p    PendingEntry
+			idle int64
+		)
+		if _, err := redigo.Scan(e, &p.ID, &p.Consumer, &idle, &p.Deliveries); err != nil {
+			return nil, fmt.Errorf("unexpected reply to XPENDING: %s", err)
+		}
+		p.Idle = time.Duration(idle) * time.Millisecond
+		pending = append(pending, p)
+	}
+
+	return pending, nil
+}
+
+// XClaim claims the entries ids of stream pending for consumers of group
+// for consumer if still pending for at least minIdle, and returns those
+// claimed. Entries deleted since they were delivered are claimed but not
+// returned.
+func XClaim(c Conn, stream, group, consumer string, minIdle time.Duration, ids ...string) ([]StreamEntry, error) {
+	args := redigo.Args{stream, group, consumer, int64(minIdle / time.Millisecond)}.AddFlat(ids)
+	return parseEntries(c.Do("XCLAIM", args...))
+}
+
+// NextID returns the smallest ID greater than id, e.g. to list pending
+// entries after id
+func NextID(id string) string {
+	parts := strings.SplitN(id, "-", 2)
+	if len(parts) != 2 {
+		return id
+	}
+	seq, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return id
+	}
+	return parts[0] + "-" + strconv.FormatUint(seq+1, 10)
+}
+
+// parseEntries parses an array of entries, each an array of an ID and an
+// array of field names and values. The fields of deleted entries are nil;
+// entries that are nil themselves, as replied by XCLAIM for deleted
+// entries before Redis 7, are skipped.
+func parseEntries(reply interface{}, err error) ([]StreamEntry, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := redigo.Values(reply, nil)
+	if err == redigo.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unexpected stream entries")
+	}
+
+	entries := make([]StreamEntry, 0, len(values))
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		e, err := redigo.Values(v, nil)
+		if err != nil || len(e) != 2 {
+			return nil, fmt.Errorf("unexpected stream entry")
+		}
+		id, err := redigo.String(e[0], nil)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected stream entry id")
+		}
+
+		entry := StreamEntry{ID: id}
+		if e[1] != nil {
+			fields, err := redigo.StringMap(e[1], nil)
+			if err != nil {
+				return nil, fmt.Errorf("unexpected stream entry fields")
+			}
+			entry.Fields = fields
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
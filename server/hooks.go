@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// hookTracker keeps track of the webhooks being received and rejects new
+// ones once closed, so that publishers are only closed once the events of
+// every webhook accepted have been published
+type hookTracker struct {
+	sync.Mutex
+
+	closed   bool
+	inFlight sync.WaitGroup
+}
+
+// Handler wraps the handler of a webhook endpoint
+func (t *hookTracker) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Lock()
+		if t.closed {
+			t.Unlock()
+			w.Header().Set("Retry-After", "60")
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		t.inFlight.Add(1)
+		t.Unlock()
+		defer t.inFlight.Done()
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Close rejects further webhooks and waits for those being received to be
+// handled or ctx to be done
+func (t *hookTracker) Close(ctx context.Context) error {
+	t.Lock()
+	t.closed = true
+	t.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		t.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("error waiting for webhooks: %s", ctx.Err())
+	}
+}
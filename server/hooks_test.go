@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHookTracker(t *testing.T) {
+	var tracker hookTracker
+
+	received := make(chan struct{})
+	release := make(chan struct{})
+	h := tracker.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+		<-release
+	}))
+
+	inFlight := httptest.NewRecorder()
+	go h.ServeHTTP(inFlight, httptest.NewRequest("POST", "/hooks/github", nil))
+	<-received
+
+	closed := make(chan error, 1)
+	go func() { closed <- tracker.Close(context.Background()) }()
+
+	for deadline := time.Now().Add(time.Second * 5); ; time.Sleep(time.Millisecond * 10) {
+		tracker.Lock()
+		rejecting := tracker.closed
+		tracker.Unlock()
+		if rejecting {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for webhooks to be rejected")
+		}
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/hooks/github", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected webhook to be rejected with %d got %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	select {
+	case <-closed:
+		t.Fatal("expected Close to wait for the webhook being received")
+	default:
+	}
+
+	close(release)
+	if err := <-closed; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/prologic/autodock/collector"
+	"github.com/prologic/autodock/config"
+	"github.com/prologic/autodock/proxy"
+)
+
+// Reload applies the settings of cfg that can be changed at runtime and
+// returns the names of the settings that were applied and of those that
+// differ but only take effect after a restart. The message bus and its
+// subscribers are left untouched.
+func (s *Server) Reload(cfg *config.Config) (applied, restart []string, err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	running := *s.cfg
+
+	var reloadLogging, reloadProxy, reloadPublishers, reloadFilters bool
+
+	for _, name := range config.Diff(s.cfg, cfg) {
+		switch {
+		case name == "debug" || name == "log_level":
+			running.Debug = cfg.Debug
+			running.LogLevel = cfg.LogLevel
+			reloadLogging = true
+		case name == "proxy.allow" || name == "proxy.deny":
+			running.Proxy.Allow = cfg.Proxy.Allow
+			running.Proxy.Deny = cfg.Proxy.Deny
+			reloadProxy = s.proxy != nil
+		case name == "msgbus_url" || name == "publishers":
+			// the embedded message bus is only exposed at startup
+			if s.publisher == nil || (cfg.LocalMessageBus() && !s.msgbusEnabled) {
+				restart = append(restart, name)
+				continue
+			}
+			running.MsgBusURL = cfg.MsgBusURL
+			running.Publishers = cfg.Publishers
+			reloadPublishers = true
+		case strings.HasPrefix(name, "collector.filters."):
+			if s.collector == nil {
+				restart = append(restart, name)
+				continue
+			}
+			running.Collector.Filters = cfg.Collector.Filters
+			reloadFilters = true
+		default:
+			restart = append(restart, name)
+			continue
+		}
+		applied = append(applied, name)
+	}
+
+	if reloadProxy {
+		rules, err := proxy.NewRules(running.Proxy.Allow, running.Proxy.Deny)
+		if err != nil {
+			return nil, nil, err
+		}
+		s.proxy.SetRules(rules)
+	}
+
+	if reloadPublishers {
+		publisher, err := s.getPublisher(&running)
+		if err != nil {
+			return nil, nil, err
+		}
+		s.publisher.Swap(publisher)
+	}
+
+	if reloadFilters {
+		s.collector.SetFilter(collector.NewFilter(running.Collector.Filters))
+	}
+
+	if reloadLogging {
+		log.SetLevel(running.Level())
+	}
+
+	s.cfg = &running
+
+	return applied, restart, nil
+}
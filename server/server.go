@@ -1,8 +1,12 @@
 package server
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/prologic/msgbus"
@@ -11,17 +15,36 @@ import (
 
 	"github.com/prologic/autodock/collector"
 	"github.com/prologic/autodock/config"
+	"github.com/prologic/autodock/events"
+	"github.com/prologic/autodock/hooks"
+	"github.com/prologic/autodock/journal"
 	"github.com/prologic/autodock/metrics"
 	"github.com/prologic/autodock/proxy"
 )
 
 // Server ...
 type Server struct {
+	sync.Mutex
+
 	cfg       *config.Config
 	msgbus    *msgbus.MessageBus
-	publisher collector.Publisher
+	publisher *collector.SwappablePublisher
+	collector *collector.Collector
+	journal   *journal.Journal
 	proxy     *proxy.Proxy
 	metrics   *metrics.Metrics
+	server    *http.Server
+
+	msgbusEnabled bool
+
+	// hooks tracks the webhooks being received
+	hooks hookTracker
+
+	// middleware and handlers are added to the collector's pipeline
+	middleware []events.Middleware
+	handlers   []events.Handler
+
+	done chan struct{}
 }
 
 // NewServer ...
@@ -30,13 +53,20 @@ func NewServer(cfg *config.Config) (*Server, error) {
 		cfg:     cfg,
 		msgbus:  msgbus.NewMessageBus(&msgbus.Options{}),
 		metrics: metrics.NewMetrics(),
+		done:    make(chan struct{}),
 	}
 
 	// uptime ticker
 	t := time.NewTicker(time.Second * 1)
 	go func() {
-		for range t.C {
-			s.metrics.Uptime.Inc()
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				s.metrics.Uptime.Inc()
+			case <-s.done:
+				return
+			}
 		}
 	}()
 
@@ -45,13 +75,83 @@ func NewServer(cfg *config.Config) (*Server, error) {
 
 // EnableCollector ...
 func (s *Server) EnableCollector() error {
-	if s.cfg.MsgBusURL == "" {
-		s.publisher = collector.NewMessageBusLocalPublisher(s.msgbus)
-	} else {
-		s.publisher = collector.NewMessageBusRemotePublisher(s.cfg.MsgBusURL)
+	publisher, err := s.getEventPublisher()
+	if err != nil {
+		return err
+	}
+
+	c, err := collector.NewCollector(s.cfg, publisher)
+	if err != nil {
+		return err
+	}
+	if err := c.Use(s.middleware...); err != nil {
+		return err
+	}
+	if err := c.Handle(s.handlers...); err != nil {
+		return err
+	}
+	if err := c.Observe(s.metrics); err != nil {
+		return err
 	}
 
-	collector.NewCollector(s.cfg, s.publisher)
+	if err := c.Start(context.Background()); err != nil {
+		return err
+	}
+	s.collector = c
+	s.metrics.WatchQueue(c)
+
+	return nil
+}
+
+// Use adds middleware to the collector's pipeline to filter or transform
+// events before they are published. Use must be called before
+// EnableCollector.
+func (s *Server) Use(middleware ...events.Middleware) {
+	s.middleware = append(s.middleware, middleware...)
+}
+
+// Handle adds handlers to be called in-process with each event published
+// by the collector. Handle must be called before EnableCollector.
+func (s *Server) Handle(handlers ...events.Handler) {
+	s.handlers = append(s.handlers, handlers...)
+}
+
+// EnableHooks enables the webhook endpoints configured under /hooks/
+func (s *Server) EnableHooks() error {
+	publisher, err := s.getEventPublisher()
+	if err != nil {
+		return err
+	}
+
+	if cfg := s.cfg.Hooks.DockerHub; cfg.Enabled {
+		http.Handle("/hooks/dockerhub", s.hooks.Handler(hooks.NewDockerHub(publisher, cfg.Token, cfg.Callback)))
+	}
+	if cfg := s.cfg.Hooks.GitHub; cfg.Enabled {
+		http.Handle("/hooks/github", s.hooks.Handler(hooks.NewGitHub(publisher, cfg.Secret)))
+	}
+	if cfg := s.cfg.Hooks.Registry; cfg.Enabled {
+		http.Handle("/hooks/registry", s.hooks.Handler(hooks.NewRegistry(publisher, cfg.Token, cfg.Actions)))
+	}
+	if sources := s.cfg.Hooks.Sources; len(sources) > 0 {
+		http.Handle("/hooks/", s.hooks.Handler(hooks.NewGeneric(publisher, sources)))
+	}
+
+	return nil
+}
+
+// EnableJournal ...
+func (s *Server) EnableJournal() error {
+	j, err := journal.Open(s.cfg.Journal.Path, journal.Options{
+		SegmentSize: s.cfg.Journal.SegmentSize,
+		MaxAge:      s.cfg.Journal.MaxAge.Duration,
+		MaxSize:     s.cfg.Journal.MaxSize,
+	})
+	if err != nil {
+		return err
+	}
+	s.journal = j
+
+	http.Handle("/journal", j)
 
 	return nil
 }
@@ -59,17 +159,26 @@ func (s *Server) EnableCollector() error {
 // EnableMessageBus ...
 func (s *Server) EnableMessageBus() error {
 	http.Handle("/events/", http.StripPrefix("/events/", s.msgbus))
+	s.msgbusEnabled = true
 	return nil
 }
 
 // EnableProxy ...
 func (s *Server) EnableProxy() error {
-	proxy, err := s.getDockerProxy()
+	p, err := s.getDockerProxy()
+	if err != nil {
+		return err
+	}
+
+	rules, err := proxy.NewRules(s.cfg.Proxy.Allow, s.cfg.Proxy.Deny)
 	if err != nil {
 		return err
 	}
+	p.SetRules(rules)
+	p.Observe(s.metrics)
+	s.proxy = p
 
-	http.Handle("/proxy/", http.StripPrefix("/proxy/", proxy))
+	http.Handle("/proxy/", http.StripPrefix("/proxy/", p))
 
 	return nil
 }
@@ -77,6 +186,7 @@ func (s *Server) EnableProxy() error {
 // Run ...
 func (s *Server) Run() error {
 	http.Handle("/metrics", prometheus.Handler())
+	http.Handle("/schema", events.SchemaHandler())
 
 	loggerMiddleware := logger.New(logger.Options{
 		Prefix:               "autodock",
@@ -86,5 +196,101 @@ func (s *Server) Run() error {
 
 	app := loggerMiddleware.Handler(http.DefaultServeMux)
 
-	return http.ListenAndServe(s.cfg.Bind, app)
+	server := &http.Server{Addr: s.cfg.Bind, Handler: app}
+
+	s.Lock()
+	s.server = server
+	s.Unlock()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+
+	var collectorErrs <-chan error
+	if s.collector != nil {
+		collectorErrs = s.collector.Err()
+	}
+
+	select {
+	case err := <-errs:
+		if err != http.ErrServerClosed {
+			return err
+		}
+	case err := <-collectorErrs:
+		return fmt.Errorf("collector failed: %s", err)
+	}
+
+	return nil
+}
+
+// Shutdown gracefully stops the server. New connections are refused while
+// in-flight requests (including streaming proxy responses) are allowed to
+// complete. Meanwhile, so that long-lived streams such as a plugin
+// following /events through the proxy don't hold them up, events already
+// received by the collector are published, the Docker client is closed,
+// further webhooks are rejected and, once those being received have been
+// handled, publishers flush their buffers. Anything still running when ctx
+// is done is abandoned and an error returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.Lock()
+	defer s.Unlock()
+
+	close(s.done)
+
+	drained := make(chan error, 1)
+	if s.server != nil {
+		go func() {
+			if err := s.server.Shutdown(ctx); err != nil {
+				s.server.Close()
+				drained <- fmt.Errorf("error draining http requests: %s", err)
+				return
+			}
+			drained <- nil
+		}()
+	} else {
+		drained <- nil
+	}
+
+	var errs []string
+
+	if s.collector != nil {
+		if err := s.collector.Shutdown(ctx); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if err := s.hooks.Close(ctx); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if s.publisher != nil {
+		closed := make(chan error, 1)
+		go func() { closed <- s.publisher.Close() }()
+
+		select {
+		case err := <-closed:
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("error closing publishers: %s", err))
+			}
+		case <-ctx.Done():
+			errs = append(errs, fmt.Sprintf("error closing publishers: %s", ctx.Err()))
+		}
+	}
+
+	if err := <-drained; err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if s.journal != nil {
+		if err := s.journal.Close(); err != nil {
+			errs = append(errs, fmt.Sprintf("error closing journal: %s", err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	return nil
 }
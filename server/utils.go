@@ -1,10 +1,20 @@
 package server
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+
 	"github.com/prologic/autodock/client"
+	"github.com/prologic/autodock/collector"
+	"github.com/prologic/autodock/config"
 	"github.com/prologic/autodock/proxy"
 )
 
+// defaultWebhookQueuePath is where webhook publishers queue events unless
+// configured otherwise
+const defaultWebhookQueuePath = "/var/lib/autodock/webhooks"
+
 func (s *Server) getDockerURL() string {
 	return client.GetDockerURL(s.cfg.DockerURL)
 }
@@ -19,3 +29,122 @@ func (s *Server) getDockerProxy() (*proxy.Proxy, error) {
 
 	return proxy.NewProxy(client.GetDockerURL(s.cfg.DockerURL), tlsConfig)
 }
+
+// getEventPublisher returns the publisher events are published to: the
+// journal, which records every event regardless of the publishers
+// configured, and the configured publishers which may change on reload
+func (s *Server) getEventPublisher() (collector.Publisher, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.publisher == nil {
+		publisher, err := s.getPublisher(s.cfg)
+		if err != nil {
+			return nil, err
+		}
+		s.publisher = collector.NewSwappablePublisher(publisher)
+	}
+
+	publishers := collector.Publishers{s.publisher}
+	if s.journal != nil {
+		publishers = append(collector.Publishers{s.journal}, publishers...)
+	}
+
+	return publishers, nil
+}
+
+// getPublisher returns a publisher fanning events out to each configured
+// publisher
+func (s *Server) getPublisher(cfg *config.Config) (collector.Publisher, error) {
+	configs := cfg.Publishers
+	if len(configs) == 0 {
+		configs = []config.PublisherConfig{
+			{
+				Name: config.PublisherMessageBus,
+				Type: config.PublisherMessageBus,
+				URL:  cfg.MsgBusURL,
+			},
+		}
+	}
+
+	fanout := collector.NewFanoutPublisher()
+	fanout.Observe(s.metrics)
+
+	for _, pc := range configs {
+		publisher, err := s.newPublisher(pc)
+		if err != nil {
+			fanout.Close()
+			return nil, fmt.Errorf("publisher %s: %s", pc.Name, err)
+		}
+
+		fanout.Add(pc.Name, publisher, pc.Buffer)
+	}
+
+	return fanout, nil
+}
+
+func (s *Server) newPublisher(pc config.PublisherConfig) (collector.Publisher, error) {
+	var publisher collector.Publisher
+
+	switch pc.Type {
+	case config.PublisherMessageBus:
+		if pc.URL == "" {
+			publisher = collector.NewMessageBusLocalPublisher(s.msgbus)
+		} else {
+			publisher = collector.NewMessageBusRemotePublisher(pc.URL)
+		}
+	case config.PublisherWebhook:
+		wc := pc.Webhook
+		if wc.QueuePath == "" {
+			wc.QueuePath = filepath.Join(defaultWebhookQueuePath, pc.Name)
+		}
+		if wc.DeadLetter == "" {
+			wc.DeadLetter = filepath.Join(wc.QueuePath, "dead-letter.jsonl")
+		}
+
+		webhook, err := collector.NewWebhookPublisher(pc.Name, pc.URL, wc)
+		if err != nil {
+			return nil, err
+		}
+		publisher = webhook
+	case config.PublisherFile:
+		file, err := collector.NewFilePublisher(pc.File)
+		if err != nil {
+			return nil, err
+		}
+		publisher = file
+	case config.PublisherMQTT:
+		publisher = collector.NewMQTTPublisher(pc.URL, pc.MQTT)
+	case config.PublisherRedis:
+		publisher = collector.NewRedisPublisher(pc.URL, pc.Redis)
+	default:
+		return nil, fmt.Errorf("unsupported type %q", pc.Type)
+	}
+
+	switch pc.Format {
+	case "", config.FormatDocker:
+	case config.FormatCloudEvents:
+		publisher = collector.NewCloudEventsPublisher(publisher, getCloudEventsSource(pc))
+	default:
+		return nil, fmt.Errorf("unsupported format %q", pc.Format)
+	}
+
+	if len(pc.Topics) > 0 {
+		publisher = collector.NewTopicFilterPublisher(publisher, pc.Topics)
+	}
+
+	return publisher, nil
+}
+
+func getCloudEventsSource(pc config.PublisherConfig) string {
+	if pc.Source != "" {
+		return pc.Source
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+
+	return fmt.Sprintf("autodock://%s", hostname)
+}